@@ -0,0 +1,134 @@
+package clientk8s
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultFieldManager is the field manager used for server-side apply when
+// ApplyOptions.FieldManager is empty.
+const DefaultFieldManager = "by-client-k8s"
+
+// ApplyOptions configures a server-side apply request. The objects applied
+// are stamped with ManagedByLabel and DesiredHashAnnotation, see DetectDrift.
+type ApplyOptions struct {
+	// FieldManager is the name of the actor owning the applied fields.
+	// Defaults to DefaultFieldManager.
+	FieldManager string
+	// Force takes ownership of fields currently owned by other managers
+	// instead of failing with an ApplyConflictError.
+	Force bool
+}
+
+func (o ApplyOptions) metav1() metav1.ApplyOptions {
+	fieldManager := o.FieldManager
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+
+	return metav1.ApplyOptions{
+		FieldManager: fieldManager,
+		Force:        o.Force,
+	}
+}
+
+// ApplyConflict is a single field owned by another field manager.
+type ApplyConflict struct {
+	// Manager is the field manager currently owning Field.
+	Manager string
+	// Field is the path of the conflicting field, e.g. ".data.key".
+	Field string
+	// Message is the raw message returned by the API server.
+	Message string
+}
+
+// ApplyConflictError is returned by the Apply* functions when the request
+// tries to change fields owned by another field manager and
+// ApplyOptions.Force is not set.
+type ApplyConflictError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Conflicts []ApplyConflict
+	Err       error
+}
+
+func (e *ApplyConflictError) Error() string {
+	var fields []string
+	for _, conflict := range e.Conflicts {
+		fields = append(fields, fmt.Sprintf("%s (owned by %q)", conflict.Field, conflict.Manager))
+	}
+
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + e.Name
+	}
+
+	return fmt.Sprintf("apply %s %s: conflicts with other field managers: %s", e.Kind, name, strings.Join(fields, ", "))
+}
+
+func (e *ApplyConflictError) Unwrap() error {
+	return e.Err
+}
+
+var conflictManagerRegexp = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+// applyError wraps the error of an apply request. Conflicts with other field
+// managers are returned as an ApplyConflictError.
+func applyError(kind, namespace, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	wrapped := newError(OpApply, kind, namespace, name, err)
+
+	var libErr *Error
+	if !apierrors.IsConflict(err) || !errors.As(wrapped, &libErr) {
+		return wrapped
+	}
+
+	var conflicts []ApplyConflict
+	for _, cause := range libErr.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+
+		conflict := ApplyConflict{
+			Field:   cause.Field,
+			Message: cause.Message,
+		}
+		if match := conflictManagerRegexp.FindStringSubmatch(cause.Message); match != nil {
+			conflict.Manager = match[1]
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	if len(conflicts) == 0 {
+		return wrapped
+	}
+
+	return &ApplyConflictError{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Conflicts: conflicts,
+		Err:       wrapped,
+	}
+}
+
+// toApplyConfiguration converts a typed object into its apply configuration
+// through their shared JSON representation.
+func toApplyConfiguration(obj interface{}, applyConfiguration interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, applyConfiguration)
+}
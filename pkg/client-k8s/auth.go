@@ -0,0 +1,184 @@
+package clientk8s
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// authOptions holds the authentication settings overriding the loaded config.
+type authOptions struct {
+	host            string
+	bearerToken     string
+	bearerTokenFile string
+	certData        []byte
+	keyData         []byte
+	caData          []byte
+	execProvider    *clientcmdapi.ExecConfig
+	impersonation   *Impersonation
+}
+
+// Impersonation is the user a client acts as. The API server authorizes the
+// requests as if that user sent them.
+type Impersonation struct {
+	UserName string
+	UID      string
+	Groups   []string
+	Extra    map[string][]string
+}
+
+// WithHost sets the URL of the API server. The config is then built from the
+// client options only, without reading a kubeconfig or the in-cluster
+// service account.
+func WithHost(host string) Option {
+	return func(c *Client) {
+		c.auth.host = host
+	}
+}
+
+// WithBearerToken authenticates the requests with a bearer token.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.auth.bearerToken = token
+	}
+}
+
+// WithBearerTokenFile authenticates the requests with the bearer token stored
+// in path. The file is read again periodically, so rotated tokens are picked
+// up without creating a new client.
+func WithBearerTokenFile(path string) Option {
+	return func(c *Client) {
+		c.auth.bearerTokenFile = path
+	}
+}
+
+// WithClientCertificate authenticates the requests with a PEM encoded client
+// certificate and key.
+func WithClientCertificate(certData, keyData []byte) Option {
+	return func(c *Client) {
+		c.auth.certData = certData
+		c.auth.keyData = keyData
+	}
+}
+
+// WithCAData sets the PEM encoded CA bundle used to verify the API server
+// certificate.
+func WithCAData(caData []byte) Option {
+	return func(c *Client) {
+		c.auth.caData = caData
+	}
+}
+
+// WithExecProvider authenticates the requests with the credentials returned
+// by an exec-credential plugin, such as a cloud provider CLI. The plugin
+// replaces the token, basic auth or auth provider of the loaded config.
+func WithExecProvider(execConfig *clientcmdapi.ExecConfig) Option {
+	return func(c *Client) {
+		c.auth.execProvider = execConfig
+	}
+}
+
+// WithImpersonation sends every request on behalf of the given user.
+func WithImpersonation(impersonation Impersonation) Option {
+	return func(c *Client) {
+		c.auth.impersonation = &impersonation
+	}
+}
+
+// configureAuth applies the authentication options to the config.
+func (c *Client) configureAuth(config *rest.Config) {
+
+	if c.auth.host != "" {
+		config.Host = c.auth.host
+	}
+
+	if c.auth.bearerToken != "" || c.auth.bearerTokenFile != "" {
+		config.BearerToken = c.auth.bearerToken
+		config.BearerTokenFile = c.auth.bearerTokenFile
+		config.Username = ""
+		config.Password = ""
+		config.AuthProvider = nil
+		config.ExecProvider = nil
+	}
+
+	if c.auth.certData != nil || c.auth.keyData != nil {
+		config.CertData = c.auth.certData
+		config.KeyData = c.auth.keyData
+		config.CertFile = ""
+		config.KeyFile = ""
+	}
+
+	if c.auth.caData != nil {
+		config.CAData = c.auth.caData
+		config.CAFile = ""
+	}
+
+	if c.auth.execProvider != nil {
+		config.ExecProvider = c.auth.execProvider
+		config.AuthProvider = nil
+		// client-go prefers a static token to the plugin.
+		config.BearerToken = ""
+		config.BearerTokenFile = ""
+		config.Username = ""
+		config.Password = ""
+	}
+
+	if c.auth.impersonation != nil {
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: c.auth.impersonation.UserName,
+			UID:      c.auth.impersonation.UID,
+			Groups:   c.auth.impersonation.Groups,
+			Extra:    c.auth.impersonation.Extra,
+		}
+	}
+
+}
+
+// Impersonate returns a copy of the client sending every request on behalf of
+// the given user, so RBAC applies to that user. The copy shares the logger,
+// metrics, tracer, retry policy and circuit breaker of c.
+func (c *Client) Impersonate(impersonation Impersonation) (*Client, error) {
+
+	if c.config == nil {
+		return nil, errors.New("impersonation needs a client created by NewClient")
+	}
+
+	clone := *c
+	clone.auth.impersonation = &impersonation
+
+	if err := clone.connect(c.config); err != nil {
+		return nil, fmt.Errorf("error impersonating %s: %w", impersonation.UserName, err)
+	}
+
+	return &clone, nil
+
+}
+
+// connect builds the clientset from the loaded config and the client
+// settings.
+func (c *Client) connect(config *rest.Config) error {
+
+	c.config = rest.CopyConfig(config)
+
+	config = rest.CopyConfig(config)
+	c.configure(config)
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error setting new config: %w", err)
+	}
+
+	c.dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("error setting new config: %w", err)
+	}
+
+	c.setClientset(clientset)
+
+	return nil
+
+}
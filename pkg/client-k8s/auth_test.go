@@ -0,0 +1,33 @@
+package clientk8s
+
+import (
+	"testing"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestExecProviderReplacesLoadedCredentials(t *testing.T) {
+
+	execConfig := &clientcmdapi.ExecConfig{Command: "cloud-auth", APIVersion: "client.authentication.k8s.io/v1beta1"}
+
+	c := &Client{}
+	WithExecProvider(execConfig)(c)
+
+	config := &rest.Config{
+		BearerToken:     "loaded-token",
+		BearerTokenFile: "/var/run/token",
+		Username:        "admin",
+		Password:        "secret",
+		AuthProvider:    &clientcmdapi.AuthProviderConfig{Name: "oidc"},
+	}
+	c.configureAuth(config)
+
+	if config.ExecProvider != execConfig {
+		t.Errorf("ExecProvider = %v, want %v", config.ExecProvider, execConfig)
+	}
+	if config.BearerToken != "" || config.BearerTokenFile != "" || config.Username != "" || config.Password != "" || config.AuthProvider != nil {
+		t.Errorf("the loaded credentials were kept: %+v", config)
+	}
+
+}
@@ -0,0 +1,235 @@
+package clientk8s
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker of a client.
+type CircuitState int
+
+// States of the circuit breaker.
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every request without sending it.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through to
+	// find out whether the API server recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitBreakerOptions configures the circuit breaker of a client.
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures opening the
+	// circuit. Defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before probing the API
+	// server again. Defaults to 30s.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe requests let through at once
+	// while half-open. The circuit closes after as many consecutive
+	// successes. Defaults to 1.
+	HalfOpenRequests int
+	// IsFailure decides which errors count as failures of the API server.
+	// Defaults to IsRetryable, so errors such as NotFound or Conflict do not
+	// open the circuit.
+	IsFailure func(error) bool
+}
+
+// CircuitOpenError is returned, wrapped in an Error, for requests failed
+// without being sent because the circuit breaker is open.
+type CircuitOpenError struct {
+	// Failures is the number of consecutive failures that opened the circuit.
+	Failures int
+	// RetryAt is when the circuit lets probe requests through again.
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open after %d consecutive failures, retry at %s", e.Failures, e.RetryAt.Format(time.RFC3339))
+}
+
+// IsCircuitOpen reports whether the request was not sent because the circuit
+// breaker is open.
+func IsCircuitOpen(err error) bool {
+	var circuitErr *CircuitOpenError
+	return errors.As(err, &circuitErr)
+}
+
+// WithCircuitBreaker fails requests fast once the API server keeps failing,
+// instead of sending and retrying them. The circuit opens after
+// FailureThreshold consecutive failures, and closes again once probe requests
+// succeed.
+func WithCircuitBreaker(opts CircuitBreakerOptions) Option {
+	return func(c *Client) {
+		c.breaker = newCircuitBreaker(opts)
+	}
+}
+
+// CircuitState returns the state of the circuit breaker, for health checks.
+// It is always CircuitClosed without WithCircuitBreaker.
+func (c *Client) CircuitState() CircuitState {
+	return c.breaker.state()
+}
+
+// circuitBreaker implements the breaker. A nil *circuitBreaker lets every
+// request through.
+type circuitBreaker struct {
+	opts CircuitBreakerOptions
+
+	mu       sync.Mutex
+	current  CircuitState
+	failures int
+	openedAt time.Time
+	probes   int
+	// successes counts the successful probes while half-open.
+	successes int
+
+	// onStateChange is called with the lock held on every transition.
+	onStateChange func(from, to CircuitState)
+}
+
+func newCircuitBreaker(opts CircuitBreakerOptions) *circuitBreaker {
+
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = IsRetryable
+	}
+
+	return &circuitBreaker{opts: opts}
+
+}
+
+func (b *circuitBreaker) state() CircuitState {
+
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.current
+
+}
+
+// allow returns a CircuitOpenError when the request must not be sent. Every
+// allowed request must be followed by a call to done.
+func (b *circuitBreaker) allow() error {
+
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == CircuitOpen && time.Since(b.openedAt) >= b.opts.OpenTimeout {
+		b.setState(CircuitHalfOpen)
+	}
+
+	switch b.current {
+	case CircuitOpen:
+		return &CircuitOpenError{Failures: b.failures, RetryAt: b.openedAt.Add(b.opts.OpenTimeout)}
+	case CircuitHalfOpen:
+		if b.probes >= b.opts.HalfOpenRequests {
+			return &CircuitOpenError{Failures: b.failures, RetryAt: time.Now()}
+		}
+		b.probes++
+	}
+
+	return nil
+
+}
+
+// done records the outcome of an allowed request.
+func (b *circuitBreaker) done(err error) {
+
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := err != nil && b.opts.IsFailure(err)
+
+	switch b.current {
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			b.open()
+		}
+	case CircuitHalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		if failed {
+			b.failures++
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.opts.HalfOpenRequests {
+			b.failures = 0
+			b.setState(CircuitClosed)
+		}
+	}
+
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+func (b *circuitBreaker) setState(state CircuitState) {
+
+	if state == b.current {
+		return
+	}
+
+	from := b.current
+	b.current = state
+	b.probes = 0
+	b.successes = 0
+
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+
+}
+
+// circuitStateChanged logs and records a transition of the circuit breaker.
+func (c *Client) circuitStateChanged(from, to CircuitState) {
+	c.logger.Info("Circuit breaker state changed", "from", from.String(), "to", to.String())
+	c.metrics.circuitState(to)
+}
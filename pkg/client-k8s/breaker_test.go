@@ -0,0 +1,171 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// breakerServer fails the config map gets while failing is set.
+type breakerServer struct {
+	failing error
+	calls   int
+}
+
+func newBreakerClient(opts CircuitBreakerOptions) (*Client, *breakerServer) {
+
+	server := &breakerServer{}
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+	})
+	clientset.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		server.calls++
+		if server.failing != nil {
+			return true, nil, server.failing
+		}
+		return false, nil, nil
+	})
+
+	return NewClientFromClientset(clientset, WithCircuitBreaker(opts)), server
+
+}
+
+func getSettings(c *Client) error {
+	_, err := c.GetConfigMap(context.Background(), "settings", "default")
+	return err
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+
+	c, server := newBreakerClient(CircuitBreakerOptions{FailureThreshold: 3, OpenTimeout: 50 * time.Millisecond})
+	server.failing = apierrors.NewServiceUnavailable("down")
+
+	// Closed until the threshold.
+	for i := 0; i < 3; i++ {
+		if state := c.CircuitState(); state != CircuitClosed {
+			t.Fatalf("state after %d failures = %s, want closed", i, state)
+		}
+		if err := getSettings(c); IsCircuitOpen(err) {
+			t.Fatalf("request %d failed fast: %v", i, err)
+		}
+	}
+	if state := c.CircuitState(); state != CircuitOpen {
+		t.Fatalf("state after 3 failures = %s, want open", state)
+	}
+
+	// Open: failed without being sent.
+	err := getSettings(c)
+	if !IsCircuitOpen(err) || server.calls != 3 {
+		t.Fatalf("request while open = %v after %d requests, want a CircuitOpenError without a request", err, server.calls)
+	}
+	var libErr *Error
+	if !errors.As(err, &libErr) || libErr.Kind != KindConfigMap {
+		t.Errorf("error while open = %v, want an Error of the request", err)
+	}
+
+	// Half-open: a failed probe opens the circuit again.
+	time.Sleep(60 * time.Millisecond)
+	if err := getSettings(c); IsCircuitOpen(err) || server.calls != 4 {
+		t.Fatalf("probe = %v after %d requests, want it sent", err, server.calls)
+	}
+	if state := c.CircuitState(); state != CircuitOpen {
+		t.Fatalf("state after a failed probe = %s, want open", state)
+	}
+
+	// A successful probe closes it.
+	server.failing = nil
+	time.Sleep(60 * time.Millisecond)
+	if err := getSettings(c); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	if state := c.CircuitState(); state != CircuitClosed {
+		t.Fatalf("state after a successful probe = %s, want closed", state)
+	}
+
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+
+	c, server := newBreakerClient(CircuitBreakerOptions{FailureThreshold: 2})
+	server.failing = apierrors.NewNotFound(configMaps, "settings")
+
+	for i := 0; i < 5; i++ {
+		if err := getSettings(c); !IsNotFound(err) {
+			t.Fatalf("GetConfigMap() error = %v, want not found", err)
+		}
+	}
+	if state := c.CircuitState(); state != CircuitClosed {
+		t.Errorf("state after not found errors = %s, want closed", state)
+	}
+
+	// A success resets the consecutive failures.
+	server.failing = apierrors.NewServiceUnavailable("down")
+	getSettings(c)
+	server.failing = nil
+	getSettings(c)
+	server.failing = apierrors.NewServiceUnavailable("down")
+	getSettings(c)
+
+	if state := c.CircuitState(); state != CircuitClosed {
+		t.Errorf("state after non-consecutive failures = %s, want closed", state)
+	}
+
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+
+	var transitions []string
+	b := newCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, OpenTimeout: time.Millisecond, HalfOpenRequests: 2})
+	b.onStateChange = func(from, to CircuitState) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	}
+
+	failure := apierrors.NewServiceUnavailable("down")
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() while closed = %v", err)
+	}
+	b.done(failure)
+
+	time.Sleep(5 * time.Millisecond)
+
+	// Only HalfOpenRequests probes at once.
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("probe %d = %v", i, err)
+		}
+	}
+	if err := b.allow(); !IsCircuitOpen(err) {
+		t.Fatalf("third probe = %v, want a CircuitOpenError", err)
+	}
+
+	// The circuit closes after as many successes.
+	b.done(nil)
+	if state := b.state(); state != CircuitHalfOpen {
+		t.Fatalf("state after one successful probe = %s, want half-open", state)
+	}
+	b.done(nil)
+
+	if want := []string{"closed->open", "open->half-open", "half-open->closed"}; !reflect.DeepEqual(transitions, want) {
+		t.Errorf("transitions = %v, want %v", transitions, want)
+	}
+
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+	if state := c.CircuitState(); state != CircuitClosed {
+		t.Errorf("state without a breaker = %s, want closed", state)
+	}
+
+}
@@ -0,0 +1,574 @@
+package clientk8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CacheOptions selects the objects held by a CachedClient.
+type CacheOptions struct {
+	// Kinds are the kinds served from the cache. Defaults to KindConfigMap
+	// and KindSecret.
+	Kinds []string
+	// Namespace restricts the cache to a namespace. Defaults to the
+	// namespace of the client; AllNamespaces caches every namespace.
+	Namespace string
+	// LabelSelector restricts the cache to the objects whose labels match.
+	LabelSelector string
+	// ResyncPeriod is how often the cached objects are replayed to the
+	// informers. Zero disables resyncs.
+	ResyncPeriod time.Duration
+}
+
+// CachedClient serves the Get* and List* functions of the cached kinds from
+// shared informers, which keep a copy of the objects up to date with a watch.
+// Reads the cache cannot answer, such as a missing object, a list with a
+// field selector or a list wider than the label selector of the cache, and
+// every write go to the API server through the embedded Client.
+type CachedClient struct {
+	*Client
+
+	namespace string
+	selector  labels.Selector
+	factory   informers.SharedInformerFactory
+	informers map[string]cache.SharedIndexInformer
+}
+
+// cachedInformers returns the informer of every kind a CachedClient can
+// cache.
+var cachedInformers = map[string]func(informers.SharedInformerFactory) cache.SharedIndexInformer{
+	KindConfigMap: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Core().V1().ConfigMaps().Informer()
+	},
+	KindSecret: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Core().V1().Secrets().Informer()
+	},
+	KindRole: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Rbac().V1().Roles().Informer()
+	},
+	KindRoleBinding: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Rbac().V1().RoleBindings().Informer()
+	},
+	KindClusterRole: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Rbac().V1().ClusterRoles().Informer()
+	},
+	KindClusterRoleBinding: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Rbac().V1().ClusterRoleBindings().Informer()
+	},
+	KindServiceAccount: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Core().V1().ServiceAccounts().Informer()
+	},
+	KindPersistentVolumeClaim: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Core().V1().PersistentVolumeClaims().Informer()
+	},
+	KindNamespace: func(factory informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return factory.Core().V1().Namespaces().Informer()
+	},
+}
+
+// NewCachedClient returns a client reading the kinds of cacheOptions from a
+// cache. The cache is filled once Start is called; until it is synced, reads
+// go to the API server.
+func (c *Client) NewCachedClient(cacheOptions CacheOptions) (*CachedClient, error) {
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	kinds := cacheOptions.Kinds
+	if len(kinds) == 0 {
+		kinds = []string{KindConfigMap, KindSecret}
+	}
+
+	namespace := c.resolveNamespace(cacheOptions.Namespace)
+
+	selector, err := labels.Parse(cacheOptions.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the cache label selector: %w", err)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clientset, cacheOptions.ResyncPeriod,
+		informers.WithNamespace(listNamespace(namespace)),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = cacheOptions.LabelSelector
+		}),
+	)
+
+	cc := &CachedClient{
+		Client:    c,
+		namespace: namespace,
+		selector:  selector,
+		factory:   factory,
+		informers: map[string]cache.SharedIndexInformer{},
+	}
+
+	for _, kind := range kinds {
+		if _, err := cc.informer(kind); err != nil {
+			return nil, err
+		}
+	}
+
+	return cc, nil
+
+}
+
+// informer returns the informer of kind, adding it to the cache when needed.
+// Informers added after Start are only started by the next call to Start.
+func (cc *CachedClient) informer(kind string) (cache.SharedIndexInformer, error) {
+
+	if informer, ok := cc.informers[kind]; ok {
+		return informer, nil
+	}
+
+	newInformer, ok := cachedInformers[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind %q", kind)
+	}
+
+	informer := newInformer(cc.factory)
+	cc.informers[kind] = informer
+
+	return informer, nil
+
+}
+
+// Start starts filling the cache, until ctx is cancelled.
+func (cc *CachedClient) Start(ctx context.Context) {
+	cc.factory.Start(ctx.Done())
+}
+
+// WaitForCacheSync waits until the cache holds every object of the cached
+// kinds, or ctx is cancelled.
+func (cc *CachedClient) WaitForCacheSync(ctx context.Context) error {
+
+	for kind, informer := range cc.informers {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			return fmt.Errorf("error syncing the %s cache: %w", kind, ctx.Err())
+		}
+	}
+
+	return nil
+
+}
+
+// cached returns the informer holding the objects of kind in namespace, or
+// nil when reads have to go to the API server.
+func (cc *CachedClient) cached(kind, namespace string) cache.SharedIndexInformer {
+
+	informer, ok := cc.informers[kind]
+	if !ok || !informer.HasSynced() {
+		return nil
+	}
+
+	if !isClusterScoped(kind) && cc.namespace != AllNamespaces && namespace != cc.namespace {
+		return nil
+	}
+
+	return informer
+
+}
+
+// getCached returns a copy of the cached object.
+func (cc *CachedClient) getCached(kind, namespace, name string) (runtime.Object, bool) {
+
+	informer := cc.cached(kind, namespace)
+	if informer == nil {
+		return nil, false
+	}
+
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+
+	obj, exists, err := informer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return nil, false
+	}
+
+	return obj.(runtime.Object).DeepCopyObject(), true
+
+}
+
+// listCached returns a copy of the cached objects matching listOptions, and
+// the resourceVersion the cache is at. The cache only filters by labels, and
+// only answers selectors at least as narrow as its own.
+func (cc *CachedClient) listCached(kind, namespace string, listOptions ListOptions) ([]runtime.Object, string, bool) {
+
+	if listOptions.FieldSelector != "" || listOptions.Limit > 0 || listOptions.Continue != "" || listOptions.ResourceVersion != "" {
+		return nil, "", false
+	}
+
+	informer := cc.cached(kind, namespace)
+	if informer == nil {
+		return nil, "", false
+	}
+
+	selector, err := labels.Parse(listOptions.LabelSelector)
+	if err != nil || !cc.covers(selector) {
+		return nil, "", false
+	}
+
+	var result []runtime.Object
+	appendFn := func(obj interface{}) {
+		result = append(result, obj.(runtime.Object).DeepCopyObject())
+	}
+
+	if isClusterScoped(kind) || namespace == AllNamespaces {
+		err = cache.ListAll(informer.GetIndexer(), selector, appendFn)
+	} else {
+		err = cache.ListAllByNamespace(informer.GetIndexer(), namespace, selector, appendFn)
+	}
+	if err != nil {
+		return nil, "", false
+	}
+
+	return result, informer.LastSyncResourceVersion(), true
+
+}
+
+// covers reports whether the cache holds every object matching selector:
+// each requirement of the cache selector is also one of selector.
+func (cc *CachedClient) covers(selector labels.Selector) bool {
+
+	required, _ := cc.selector.Requirements()
+	requested, _ := selector.Requirements()
+
+	for _, requirement := range required {
+		found := false
+		for _, item := range requested {
+			if item.Equal(requirement) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// GetConfigMap returns the config map from the cache, or from the API server
+// when the cache does not hold it.
+func (cc *CachedClient) GetConfigMap(ctx context.Context, name, namespace string) (*v1.ConfigMap, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	if obj, ok := cc.getCached(KindConfigMap, namespace, name); ok {
+		return obj.(*v1.ConfigMap), nil
+	}
+
+	return cc.Client.GetConfigMap(ctx, name, namespace)
+
+}
+
+// ListConfigMap lists the config maps from the cache, or from the API server
+// when the cache does not hold the namespace or listOptions needs more than a
+// label selector.
+func (cc *CachedClient) ListConfigMap(ctx context.Context, namespace string, listOptions ListOptions) (*v1.ConfigMapList, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	items, listResourceVersion, ok := cc.listCached(KindConfigMap, namespace, listOptions)
+	if !ok {
+		return cc.Client.ListConfigMap(ctx, namespace, listOptions)
+	}
+
+	result := &v1.ConfigMapList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*v1.ConfigMap))
+	}
+
+	return result, nil
+
+}
+
+// GetSecret returns the secret from the cache, or from the API server when the
+// cache does not hold it.
+func (cc *CachedClient) GetSecret(ctx context.Context, name, namespace string) (*v1.Secret, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	if obj, ok := cc.getCached(KindSecret, namespace, name); ok {
+		return obj.(*v1.Secret), nil
+	}
+
+	return cc.Client.GetSecret(ctx, name, namespace)
+
+}
+
+// ListSecret lists the secrets from the cache, or from the API server when the
+// cache does not hold the namespace or listOptions needs more than a label
+// selector.
+func (cc *CachedClient) ListSecret(ctx context.Context, namespace string, listOptions ListOptions) (*v1.SecretList, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	items, listResourceVersion, ok := cc.listCached(KindSecret, namespace, listOptions)
+	if !ok {
+		return cc.Client.ListSecret(ctx, namespace, listOptions)
+	}
+
+	result := &v1.SecretList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*v1.Secret))
+	}
+
+	return result, nil
+
+}
+
+// GetRole returns the role from the cache, or from the API server when the
+// cache does not hold it.
+func (cc *CachedClient) GetRole(ctx context.Context, name, namespace string) (*rbacv1.Role, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	if obj, ok := cc.getCached(KindRole, namespace, name); ok {
+		return obj.(*rbacv1.Role), nil
+	}
+
+	return cc.Client.GetRole(ctx, name, namespace)
+
+}
+
+// ListRole lists the roles from the cache, or from the API server when the
+// cache does not hold the namespace or listOptions needs more than a label
+// selector.
+func (cc *CachedClient) ListRole(ctx context.Context, namespace string, listOptions ListOptions) (*rbacv1.RoleList, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	items, listResourceVersion, ok := cc.listCached(KindRole, namespace, listOptions)
+	if !ok {
+		return cc.Client.ListRole(ctx, namespace, listOptions)
+	}
+
+	result := &rbacv1.RoleList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*rbacv1.Role))
+	}
+
+	return result, nil
+
+}
+
+// GetRoleBinding returns the role binding from the cache, or from the API
+// server when the cache does not hold it.
+func (cc *CachedClient) GetRoleBinding(ctx context.Context, name, namespace string) (*rbacv1.RoleBinding, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	if obj, ok := cc.getCached(KindRoleBinding, namespace, name); ok {
+		return obj.(*rbacv1.RoleBinding), nil
+	}
+
+	return cc.Client.GetRoleBinding(ctx, name, namespace)
+
+}
+
+// ListRoleBinding lists the role bindings from the cache, or from the API
+// server when the cache does not hold the namespace or listOptions needs more
+// than a label selector.
+func (cc *CachedClient) ListRoleBinding(ctx context.Context, namespace string, listOptions ListOptions) (*rbacv1.RoleBindingList, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	items, listResourceVersion, ok := cc.listCached(KindRoleBinding, namespace, listOptions)
+	if !ok {
+		return cc.Client.ListRoleBinding(ctx, namespace, listOptions)
+	}
+
+	result := &rbacv1.RoleBindingList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*rbacv1.RoleBinding))
+	}
+
+	return result, nil
+
+}
+
+// GetClusterRole returns the cluster role from the cache, or from the API
+// server when the cache does not hold it.
+func (cc *CachedClient) GetClusterRole(ctx context.Context, name string) (*rbacv1.ClusterRole, error) {
+
+	if obj, ok := cc.getCached(KindClusterRole, "", name); ok {
+		return obj.(*rbacv1.ClusterRole), nil
+	}
+
+	return cc.Client.GetClusterRole(ctx, name)
+
+}
+
+// ListClusterRole lists the cluster roles from the cache, or from the API
+// server when listOptions needs more than a label selector.
+func (cc *CachedClient) ListClusterRole(ctx context.Context, listOptions ListOptions) (*rbacv1.ClusterRoleList, error) {
+
+	items, listResourceVersion, ok := cc.listCached(KindClusterRole, "", listOptions)
+	if !ok {
+		return cc.Client.ListClusterRole(ctx, listOptions)
+	}
+
+	result := &rbacv1.ClusterRoleList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*rbacv1.ClusterRole))
+	}
+
+	return result, nil
+
+}
+
+// GetClusterRoleBinding returns the cluster role binding from the cache, or
+// from the API server when the cache does not hold it.
+func (cc *CachedClient) GetClusterRoleBinding(ctx context.Context, name string) (*rbacv1.ClusterRoleBinding, error) {
+
+	if obj, ok := cc.getCached(KindClusterRoleBinding, "", name); ok {
+		return obj.(*rbacv1.ClusterRoleBinding), nil
+	}
+
+	return cc.Client.GetClusterRoleBinding(ctx, name)
+
+}
+
+// ListClusterRoleBinding lists the cluster role bindings from the cache, or
+// from the API server when listOptions needs more than a label selector.
+func (cc *CachedClient) ListClusterRoleBinding(ctx context.Context, listOptions ListOptions) (*rbacv1.ClusterRoleBindingList, error) {
+
+	items, listResourceVersion, ok := cc.listCached(KindClusterRoleBinding, "", listOptions)
+	if !ok {
+		return cc.Client.ListClusterRoleBinding(ctx, listOptions)
+	}
+
+	result := &rbacv1.ClusterRoleBindingList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*rbacv1.ClusterRoleBinding))
+	}
+
+	return result, nil
+
+}
+
+// GetServiceAccount returns the service account from the cache, or from the
+// API server when the cache does not hold it.
+func (cc *CachedClient) GetServiceAccount(ctx context.Context, name, namespace string) (*v1.ServiceAccount, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	if obj, ok := cc.getCached(KindServiceAccount, namespace, name); ok {
+		return obj.(*v1.ServiceAccount), nil
+	}
+
+	return cc.Client.GetServiceAccount(ctx, name, namespace)
+
+}
+
+// ListServiceAccount lists the service accounts from the cache, or from the
+// API server when the cache does not hold the namespace or listOptions needs
+// more than a label selector.
+func (cc *CachedClient) ListServiceAccount(ctx context.Context, namespace string, listOptions ListOptions) (*v1.ServiceAccountList, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	items, listResourceVersion, ok := cc.listCached(KindServiceAccount, namespace, listOptions)
+	if !ok {
+		return cc.Client.ListServiceAccount(ctx, namespace, listOptions)
+	}
+
+	result := &v1.ServiceAccountList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*v1.ServiceAccount))
+	}
+
+	return result, nil
+
+}
+
+// GetPVC returns the pvc from the cache, or from the API server when the cache
+// does not hold it.
+func (cc *CachedClient) GetPVC(ctx context.Context, name, namespace string) (*v1.PersistentVolumeClaim, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	if obj, ok := cc.getCached(KindPersistentVolumeClaim, namespace, name); ok {
+		return obj.(*v1.PersistentVolumeClaim), nil
+	}
+
+	return cc.Client.GetPVC(ctx, name, namespace)
+
+}
+
+// ListPVC lists the pvcs from the cache, or from the API server when the cache
+// does not hold the namespace or listOptions needs more than a label selector.
+func (cc *CachedClient) ListPVC(ctx context.Context, namespace string, listOptions ListOptions) (*v1.PersistentVolumeClaimList, error) {
+
+	namespace = cc.resolveNamespace(namespace)
+
+	items, listResourceVersion, ok := cc.listCached(KindPersistentVolumeClaim, namespace, listOptions)
+	if !ok {
+		return cc.Client.ListPVC(ctx, namespace, listOptions)
+	}
+
+	result := &v1.PersistentVolumeClaimList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*v1.PersistentVolumeClaim))
+	}
+
+	return result, nil
+
+}
+
+// GetNamespace returns the namespace from the cache, or from the API server
+// when the cache does not hold it.
+func (cc *CachedClient) GetNamespace(ctx context.Context, name string) (*v1.Namespace, error) {
+
+	if obj, ok := cc.getCached(KindNamespace, "", name); ok {
+		return obj.(*v1.Namespace), nil
+	}
+
+	return cc.Client.GetNamespace(ctx, name)
+
+}
+
+// ListNamespace lists the namespaces from the cache, or from the API server
+// when listOptions needs more than a label selector.
+func (cc *CachedClient) ListNamespace(ctx context.Context, listOptions ListOptions) (*v1.NamespaceList, error) {
+
+	items, listResourceVersion, ok := cc.listCached(KindNamespace, "", listOptions)
+	if !ok {
+		return cc.Client.ListNamespace(ctx, listOptions)
+	}
+
+	result := &v1.NamespaceList{}
+	result.ResourceVersion = listResourceVersion
+	for _, obj := range items {
+		result.Items = append(result.Items, *obj.(*v1.Namespace))
+	}
+
+	return result, nil
+
+}
+
+// NewCachedClient calls Client.NewCachedClient on the default client.
+func NewCachedClient(cacheOptions CacheOptions) (*CachedClient, error) {
+	return defaultClient().NewCachedClient(cacheOptions)
+}
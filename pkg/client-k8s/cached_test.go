@@ -0,0 +1,145 @@
+package clientk8s
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newSyncedCachedClient returns a cached client of the config maps of
+// clientset matching labelSelector, with its cache synced, and a function
+// returning the number of requests of a verb sent to the API server since.
+func newSyncedCachedClient(t *testing.T, clientset *fake.Clientset, labelSelector string) (*CachedClient, func(verb string) int) {
+
+	t.Helper()
+
+	cc, err := NewClientFromClientset(clientset).NewCachedClient(CacheOptions{
+		Kinds:         []string{KindConfigMap},
+		Namespace:     "default",
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		t.Fatalf("NewCachedClient() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cc.Start(ctx)
+
+	syncCtx, syncCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer syncCancel()
+	if err := cc.WaitForCacheSync(syncCtx); err != nil {
+		t.Fatalf("WaitForCacheSync() error = %v", err)
+	}
+
+	synced := len(clientset.Actions())
+	requests := func(verb string) int {
+		count := 0
+		for _, action := range clientset.Actions()[synced:] {
+			if action.GetVerb() == verb {
+				count++
+			}
+		}
+		return count
+	}
+
+	return cc, requests
+
+}
+
+func labelledConfigMap(name string, labels map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}}
+}
+
+func configMapNames(list *v1.ConfigMapList) []string {
+
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+	sort.Strings(names)
+
+	return names
+
+}
+
+func TestCachedListFallsBackOutsideTheCacheSelector(t *testing.T) {
+
+	ctx := context.Background()
+	cc, requests := newSyncedCachedClient(t, fake.NewSimpleClientset(
+		labelledConfigMap("web", map[string]string{"app": "web", "tier": "front"}),
+		labelledConfigMap("api", map[string]string{"app": "web", "tier": "back"}),
+		labelledConfigMap("db", map[string]string{"app": "db"}),
+	), "app=web")
+
+	tests := []struct {
+		labelSelector string
+		want          []string
+		live          bool
+	}{
+		{"app=web", []string{"api", "web"}, false},
+		{"app=web,tier=front", []string{"web"}, false},
+		{"", []string{"api", "db", "web"}, true},
+		{"tier=front", []string{"web"}, true},
+		{"app=db", []string{"db"}, true},
+	}
+	for _, tt := range tests {
+		before := requests("list")
+
+		list, err := cc.ListConfigMap(ctx, "default", ListOptions{LabelSelector: tt.labelSelector})
+		if err != nil {
+			t.Fatalf("ListConfigMap(%q) error = %v", tt.labelSelector, err)
+		}
+
+		if got := configMapNames(list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListConfigMap(%q) = %v, want %v", tt.labelSelector, got, tt.want)
+		}
+		if live := requests("list") > before; live != tt.live {
+			t.Errorf("ListConfigMap(%q) sent to the API server = %v, want %v", tt.labelSelector, live, tt.live)
+		}
+	}
+
+}
+
+func TestCachedGetFallsBackOnMiss(t *testing.T) {
+
+	ctx := context.Background()
+	cc, requests := newSyncedCachedClient(t, fake.NewSimpleClientset(
+		labelledConfigMap("web", map[string]string{"app": "web"}),
+		labelledConfigMap("db", map[string]string{"app": "db"}),
+	), "app=web")
+
+	if _, err := cc.GetConfigMap(ctx, "web", "default"); err != nil {
+		t.Fatalf("GetConfigMap() of a cached object error = %v", err)
+	}
+	if requests("get") != 0 {
+		t.Errorf("GetConfigMap() of a cached object was sent to the API server")
+	}
+
+	if _, err := cc.GetConfigMap(ctx, "db", "default"); err != nil {
+		t.Fatalf("GetConfigMap() outside the cache error = %v", err)
+	}
+	if requests("get") != 1 {
+		t.Errorf("GetConfigMap() outside the cache wasn't sent to the API server")
+	}
+	if _, err := cc.GetConfigMap(ctx, "missing", "default"); !IsNotFound(err) {
+		t.Fatalf("GetConfigMap() of a missing object error = %v, want not found", err)
+	}
+
+}
+
+func TestNewCachedClientInvalidSelector(t *testing.T) {
+
+	_, err := NewClientFromClientset(fake.NewSimpleClientset()).NewCachedClient(CacheOptions{LabelSelector: "app in ("})
+	if err == nil {
+		t.Fatal("NewCachedClient() with an invalid selector returned no error")
+	}
+
+}
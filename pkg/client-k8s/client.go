@@ -1,18 +1,53 @@
 package clientk8s
 
 import (
-	"log"
-	"os"
+	"fmt"
+	"net/http"
 	"sync"
-
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var (
+	defaultClientOnce sync.Once
+	defaultClientMain *Client
+	defaultClientErr  error
+)
+
+// Kinds handled by the package.
+const (
+	KindConfigMap             = "ConfigMap"
+	KindSecret                = "Secret"
+	KindRole                  = "Role"
+	KindRoleBinding           = "RoleBinding"
+	KindClusterRole           = "ClusterRole"
+	KindClusterRoleBinding    = "ClusterRoleBinding"
+	KindServiceAccount        = "ServiceAccount"
+	KindPersistentVolumeClaim = "PersistentVolumeClaim"
+	KindNamespace             = "Namespace"
+	KindDeployment            = "Deployment"
 )
 
-var doOnce sync.Once
-var k8sClientSet *kubernetes.Clientset
+// OperationResult is the action taken by a CreateOrUpdate* function.
+type OperationResult string
+
+const (
+	OperationResultCreated   OperationResult = "created"
+	OperationResultUpdated   OperationResult = "updated"
+	OperationResultUnchanged OperationResult = "unchanged"
+)
 
 // Generic
 type Metav1TypeMeta struct {
@@ -20,6 +55,24 @@ type Metav1TypeMeta struct {
 	APIVersion string
 }
 
+// withDefaults returns the type meta, with kind and apiVersion filling the
+// fields left empty.
+func (t Metav1TypeMeta) withDefaults(kind, apiVersion string) metav1.TypeMeta {
+
+	if t.Kind == "" {
+		t.Kind = kind
+	}
+	if t.APIVersion == "" {
+		t.APIVersion = apiVersion
+	}
+
+	return metav1.TypeMeta{
+		Kind:       t.Kind,
+		APIVersion: t.APIVersion,
+	}
+
+}
+
 type Metav1ObjectMeta struct {
 	Name        string
 	Namespace   string
@@ -27,6 +80,8 @@ type Metav1ObjectMeta struct {
 	Annotations map[string]string
 }
 
+// Metav1CreateOptions configures the create, update and patch requests, see
+// WithCreateOptions.
 type Metav1CreateOptions struct {
 	// Valid values are:
 	// - Ignore: ignores unknown/duplicate fields.
@@ -116,10 +171,10 @@ type VolumeDevicesStruct struct {
 }
 
 type ResourceListStruct struct {
-	resourcesLimitsCPU      string
-	resourcesLimitsMemory   string
-	resourcesRequestsCPU    string
-	resourcesRequestsMemory string
+	ResourcesLimitsCPU      string
+	ResourcesLimitsMemory   string
+	ResourcesRequestsCPU    string
+	ResourcesRequestsMemory string
 }
 
 type DeploymentContainerStruct struct {
@@ -136,48 +191,195 @@ type DeploymentContainerStruct struct {
 	ContainerResource      ResourceListStruct
 }
 
-func init() {
-	doOnce.Do(func() {
-		if k8sClientSet == nil {
+// Client performs the operations of the package against one cluster. The
+// package level functions use the default client: see DefaultClient, which
+// creates it from the environment on first use, and SetDefaultClient, which
+// replaces it. When it can't be created, they return the load error.
+type Client struct {
+	clientset       kubernetes.Interface
+	dynamicClient   dynamic.Interface
+	restMapper      meta.RESTMapper
+	logger          logr.Logger
+	metrics         *metrics
+	tracerProvider  trace.TracerProvider
+	tracer          trace.Tracer
+	retryPolicy     RetryPolicy
+	qps             float32
+	burst           int
+	timeout         time.Duration
+	rateLimiter     flowcontrol.RateLimiter
+	breaker         *circuitBreaker
+	auth            authOptions
+	dryRun          bool
+	fieldValidation string
+	warningHandler  func(warning string)
+	owner           string
+	kubeconfig      string
+	context         string
+	namespace       string
+	configSource    ConfigSource
+	// config is the loaded config, before the client settings are applied.
+	config *rest.Config
+	// err fails every request of a default client that couldn't be created.
+	err error
+	// metricsErr is the error registering the collectors of WithMetrics,
+	// logged once the logger is set.
+	metricsErr error
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithLogger sets the logger receiving one entry per request, with the kind,
+// namespace, name, verb and duration as key/values. Failed requests are logged
+// as errors and successful ones at V(1). The default logger discards
+// everything.
+func WithLogger(logger logr.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// NewClient creates a client from the first config source available, from
+// the options to the in-cluster service account; ConfigSource reports which
+// one was used. The authentication options override the credentials of the
+// loaded config.
+func NewClient(opts ...Option) (*Client, error) {
+
+	c := newClient(opts)
+
+	config, err := c.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.connect(config); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+
+}
+
+// NewClientFromClientset creates a client using an existing clientset, such
+// as the fake clientset in tests.
+func NewClientFromClientset(clientset kubernetes.Interface, opts ...Option) *Client {
+
+	c := newClient(opts)
+	c.setClientset(clientset)
+
+	return c
+
+}
+
+func newClient(opts []Option) *Client {
+
+	c := &Client{
+		logger:         logr.Discard(),
+		tracerProvider: otel.GetTracerProvider(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.tracer = c.tracerProvider.Tracer(tracerName)
+
+	if c.metricsErr != nil {
+		c.logger.Error(c.metricsErr, "Registering the metrics failed, they are recorded but not exported")
+	}
+
+	if c.breaker != nil {
+		c.breaker.onStateChange = c.circuitStateChanged
+	}
+
+	return c
+
+}
+
+// configure applies the client settings to the config used to build the
+// clientset.
+func (c *Client) configure(config *rest.Config) {
+
+	c.configureAuth(config)
+	c.configureRateLimits(config)
+	c.configureWarnings(config)
+
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt, otelhttp.WithTracerProvider(c.tracerProvider))
+	})
+
+}
 
-			k8sClientSet, err = createClient()
+// Clientset returns the underlying clientset, for requests the package does
+// not cover.
+func (c *Client) Clientset() kubernetes.Interface {
+	return c.clientset
+}
 
-			if err != nil {
-				log.Fatalf("Error get client: %v", err)
-			}
+// DefaultClient returns the client used by the package level functions. It
+// is created from the environment on first use, unless SetDefaultClient was
+// called; the error tells why it couldn't be, in which case the package level
+// functions fail with that error.
+func DefaultClient() (*Client, error) {
 
+	defaultClientOnce.Do(func() {
+		if defaultClientMain == nil {
+			defaultClientMain, defaultClientErr = NewClient()
 		}
 	})
+
+	return defaultClientMain, defaultClientErr
+
 }
 
-var err error
+// SetDefaultClient replaces the client used by the package level functions.
+// It is meant to be called once at startup.
+func SetDefaultClient(c *Client) {
 
-// createClient ...
-func createClient() (*kubernetes.Clientset, error) {
+	defaultClientOnce.Do(func() {})
 
-	isCluster := os.Getenv("CLIENT_K8S_RUN_IN_CLUSTER")
+	defaultClientMain, defaultClientErr = c, nil
 
-	var config *rest.Config
+}
+
+// SetLogger sets the logger of the default client. It is meant to be called
+// once at startup.
+func SetLogger(logger logr.Logger) {
 
-	if isCluster == "cluster" {
-		config, err = rest.InClusterConfig()
-	} else {
-		config, err = clientcmd.BuildConfigFromFlags("", os.Getenv("CLIENT_K8S_KUBECONFIG"))
+	if c, err := DefaultClient(); err == nil {
+		c.logger = logger
 	}
 
-	if err != nil {
-		log.Fatalf("Error connection in ClusterConfig: %s", err)
-		return nil, err
+}
 
-	}
+// defaultClient returns the client used by the package level functions, or
+// a client failing every request with the error it couldn't be created with.
+func defaultClient() *Client {
 
-	clientset, err := kubernetes.NewForConfig(config)
+	c, err := DefaultClient()
 	if err != nil {
-		log.Fatalf("Error setting new config: %v", err)
-		return nil, err
-
+		failed := newClient(nil)
+		failed.err = fmt.Errorf("error creating the default client: %w", err)
+		return failed
 	}
 
-	return clientset, nil
+	return c
+
+}
+
+// isClusterScoped reports whether objects of kind have no namespace.
+func isClusterScoped(kind string) bool {
+	switch kind {
+	case KindClusterRole, KindClusterRoleBinding, KindNamespace:
+		return true
+	default:
+		return false
+	}
+}
 
+// isCreateOrUpdateConflict reports whether a CreateOrUpdate* attempt lost a
+// race with another writer and should be retried from the Get.
+func isCreateOrUpdateConflict(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
 }
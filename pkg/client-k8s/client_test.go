@@ -0,0 +1,74 @@
+package clientk8s
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// resetDefaultClient forgets the default client, so that the next package
+// level call creates it again.
+func resetDefaultClient(t *testing.T) {
+
+	t.Helper()
+
+	reset := func() {
+		defaultClientOnce = sync.Once{}
+		defaultClientMain = nil
+		defaultClientErr = nil
+	}
+
+	reset()
+	t.Cleanup(reset)
+
+}
+
+func TestDefaultClientLoadError(t *testing.T) {
+
+	resetDefaultClient(t)
+	t.Setenv("CLIENT_K8S_KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := DefaultClient(); err == nil {
+		t.Fatal("DefaultClient() returned no error without a config")
+	}
+
+	_, err := GetConfigMap("settings", "default")
+	if err == nil || !strings.Contains(err.Error(), "error creating the default client") {
+		t.Fatalf("GetConfigMap() error = %v, want the load error", err)
+	}
+
+	if _, err := Resource(driftKinds[0]); err == nil {
+		t.Fatal("Resource() returned no error without a config")
+	}
+
+	if err := WatchConfigMap("default", ListOptions{}, func(ConfigMapEvent) error { return nil }); err == nil {
+		t.Fatal("WatchConfigMap() returned no error without a config")
+	}
+
+}
+
+func TestSetDefaultClient(t *testing.T) {
+
+	resetDefaultClient(t)
+	t.Setenv("CLIENT_K8S_KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+	SetDefaultClient(c)
+
+	got, err := DefaultClient()
+	if err != nil || got != c {
+		t.Fatalf("DefaultClient() = %p, %v, want %p", got, err, c)
+	}
+
+	if err := CreateConfigMap(Metav1TypeMeta{}, Metav1ObjectMeta{Name: "settings", Namespace: "default"}, map[string]string{"key": "value"}); err != nil {
+		t.Fatalf("CreateConfigMap() error = %v", err)
+	}
+
+	if _, err := GetConfigMap("settings", "default"); err != nil {
+		t.Fatalf("GetConfigMap() error = %v", err)
+	}
+
+}
@@ -2,35 +2,25 @@ package clientk8s
 
 import (
 	"context"
-	"log"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
 )
 
-// CreateClusterRole ...
-func CreateClusterRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
-
-	context := context.Background()
+// GenerateClusterRole returns the cluster role CreateClusterRole creates,
+// without sending it to the API server.
+func GenerateClusterRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) *rbacv1.ClusterRole {
 
-	var policyRules []rbacv1.PolicyRule
+	policyRules := policyRulesFrom(rules)
 
-	for _, item := range rules {
-		policyRules = append(policyRules, rbacv1.PolicyRule{
-			Verbs:           item.Verbs,
-			APIGroups:       item.APIGroups,
-			Resources:       item.Resources,
-			ResourceNames:   item.ResourceNames,
-			NonResourceURLs: item.NonResourceURLs,
-		})
-	}
-
-	roleSpec := &rbacv1.ClusterRole{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return &rbacv1.ClusterRole{
+		TypeMeta: typeMeta.withDefaults(KindClusterRole, "rbac.authorization.k8s.io/v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -40,25 +30,32 @@ func CreateClusterRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rul
 		Rules: policyRules,
 	}
 
-	_, err = k8sClientSet.RbacV1().ClusterRoles().Create(context, roleSpec, metav1.CreateOptions{})
+}
 
-	if err != nil {
-		log.Printf("Error creating cluster role: %v \n", err)
-		return err
-	}
+// CreateClusterRole creates the cluster role GenerateClusterRole returns.
+func (c *Client) CreateClusterRole(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
 
-	return nil
+	roleSpec := GenerateClusterRole(typeMeta, objectMeta, rules)
+	c.labelOwner(roleSpec)
+
+	return c.do(ctx, OpCreate, KindClusterRole, "", objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().ClusterRoles().Create(ctx, roleSpec, c.createOptions())
+		return err
+	})
 
 }
 
-func GetClusterRole(name string) (*rbacv1.ClusterRole, error) {
+func (c *Client) GetClusterRole(ctx context.Context, name string) (*rbacv1.ClusterRole, error) {
 
-	context := context.Background()
+	var result *rbacv1.ClusterRole
 
-	result, err := k8sClientSet.RbacV1().ClusterRoles().Get(context, name, metav1.GetOptions{})
+	err := c.do(ctx, OpGet, KindClusterRole, "", name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().ClusterRoles().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting cluster role: %v \n", err)
 		return nil, err
 	}
 
@@ -66,43 +63,32 @@ func GetClusterRole(name string) (*rbacv1.ClusterRole, error) {
 
 }
 
-func UpdateClusterRole(objClusterRole *rbacv1.ClusterRole, rules []Rbacv1PolicyRule) error {
-
-	context := context.Background()
+func (c *Client) UpdateClusterRole(ctx context.Context, objClusterRole *rbacv1.ClusterRole, rules []Rbacv1PolicyRule) error {
 
-	var policyRules []rbacv1.PolicyRule
+	c.labelOwner(objClusterRole)
 
-	for _, item := range rules {
-		policyRules = append(policyRules, rbacv1.PolicyRule{
-			Verbs:           item.Verbs,
-			APIGroups:       item.APIGroups,
-			Resources:       item.Resources,
-			ResourceNames:   item.ResourceNames,
-			NonResourceURLs: item.NonResourceURLs,
-		})
-	}
+	policyRules := policyRulesFrom(rules)
 
 	objClusterRole.Rules = policyRules
 
-	_, err := k8sClientSet.RbacV1().ClusterRoles().Update(context, objClusterRole, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating cluster role: %v \n", err)
+	return c.do(ctx, OpUpdate, KindClusterRole, "", objClusterRole.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().ClusterRoles().Update(ctx, objClusterRole, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListClusterRole() (*rbacv1.ClusterRoleList, error) {
+func (c *Client) ListClusterRole(ctx context.Context, listOptions ListOptions) (*rbacv1.ClusterRoleList, error) {
 
-	context := context.Background()
+	var result *rbacv1.ClusterRoleList
 
-	result, err := k8sClientSet.RbacV1().ClusterRoles().List(context, metav1.ListOptions{})
+	err := c.do(ctx, OpList, KindClusterRole, "", "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().ClusterRoles().List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list clusters role: %v \n", err)
 		return nil, err
 	}
 
@@ -110,50 +96,194 @@ func ListClusterRole() (*rbacv1.ClusterRoleList, error) {
 
 }
 
-func DeleteClusterRole(name string) error {
-
-	context := context.Background()
+// EachClusterRole calls fn for every cluster role matching listOptions,
+// fetching them page by page. It stops at the first error returned by fn.
+func (c *Client) EachClusterRole(ctx context.Context, listOptions ListOptions, fn func(*rbacv1.ClusterRole) error) error {
+	return c.each(ctx, KindClusterRole, "", listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.RbacV1().ClusterRoles().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*rbacv1.ClusterRole))
+	})
+}
 
-	deletePolicy := metav1.DeletePropagationForeground
+// ClusterRoleEvent is a change of a cluster role reported by WatchClusterRole.
+type ClusterRoleEvent struct {
+	Type        EventType
+	ClusterRole *rbacv1.ClusterRole
+}
 
-	err := k8sClientSet.RbacV1().ClusterRoles().Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+// WatchClusterRole calls fn for every change of the cluster roles matching
+// listOptions, until ctx is cancelled or fn returns an error. It starts with
+// an Added event per existing cluster role, unless listOptions.ResourceVersion
+// is set, and resumes from the last resourceVersion when the connection drops.
+func (c *Client) WatchClusterRole(ctx context.Context, listOptions ListOptions, fn func(ClusterRoleEvent) error) error {
+	return c.watch(ctx, KindClusterRole, "", listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.RbacV1().ClusterRoles().List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.RbacV1().ClusterRoles().Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(ClusterRoleEvent{Type: eventType, ClusterRole: obj.(*rbacv1.ClusterRole)})
 	})
+}
 
-	if err != nil {
-		log.Printf("Error delete cluster role: %v \n", err)
-		return err
-	}
+func (c *Client) DeleteClusterRole(ctx context.Context, name string) error {
 
-	return nil
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindClusterRole, "", name, func(ctx context.Context) error {
+		return c.clientset.RbacV1().ClusterRoles().Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdateClusterRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetClusterRole(objectMeta.Name)
-		if getErr != nil {
-			log.Printf("Error getting cluster role: %v \n", err)
-			// return err
+func (c *Client) CreateOrUpdateClusterRole(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) (OperationResult, error) {
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindClusterRole, "", objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetClusterRole(ctx, objectMeta.Name)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
 
-		if resultGet != nil {
-			err := UpdateClusterRole(resultGet, rules)
+		if getErr == nil {
+			if equality.Semantic.DeepEqual(resultGet.Rules, policyRulesFrom(rules)) && c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			err := c.UpdateClusterRole(ctx, resultGet, rules)
 			if err != nil {
-				log.Printf("Error updating cluster role: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
 		} else {
-			err := CreateClusterRole(typeMeta, objectMeta, rules)
+			err := c.CreateClusterRole(ctx, typeMeta, objectMeta, rules)
 			if err != nil {
-				log.Printf("Error creating cluster role: %v \n", err)
 				return err
 			}
+			result = OperationResultCreated
 		}
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
 	}
-	return nil
+	return result, nil
+}
+
+// ApplyClusterRole creates or updates the cluster role using server-side
+// apply, so only the fields given here are owned by the field manager.
+func (c *Client) ApplyClusterRole(ctx context.Context, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule, applyOptions ApplyOptions) error {
+
+	clusterRoleApply := rbacv1ac.ClusterRole(objectMeta.Name).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations).
+		WithRules(policyRuleApplyConfigurations(rules)...)
+
+	labels, annotations, err := c.driftStamps(clusterRoleApply)
+	if err != nil {
+		return newError(OpApply, KindClusterRole, "", objectMeta.Name, err)
+	}
+	clusterRoleApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindClusterRole, "", objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().ClusterRoles().Apply(ctx, clusterRoleApply, c.applyOptions(applyOptions))
+		return applyError(KindClusterRole, "", objectMeta.Name, err)
+	})
+
+}
+
+// AddClusterRoleRules appends the rules not already granted by the cluster
+// role, keeping the rules added by other writers.
+func (c *Client) AddClusterRoleRules(ctx context.Context, name string, rules []Rbacv1PolicyRule) error {
+	return c.patchClusterRoleRules(ctx, name, func(current []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+		return addPolicyRules(current, rules)
+	})
+}
+
+// RemoveClusterRoleRules removes the given rules from the cluster role.
+func (c *Client) RemoveClusterRoleRules(ctx context.Context, name string, rules []Rbacv1PolicyRule) error {
+	return c.patchClusterRoleRules(ctx, name, func(current []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+		return removePolicyRules(current, rules)
+	})
+}
+
+func (c *Client) patchClusterRoleRules(ctx context.Context, name string, change func([]rbacv1.PolicyRule) []rbacv1.PolicyRule) error {
+	return c.retryOnConflict(ctx, OpPatch, KindClusterRole, "", name, func(ctx context.Context) error {
+		clusterRole, err := c.GetClusterRole(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		patch, err := mergePatchWithResourceVersion(clusterRole.ResourceVersion, map[string]interface{}{
+			"rules": change(clusterRole.Rules),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.Patch(ctx, KindClusterRole, name, "", types.MergePatchType, patch)
+	})
+}
+
+// CreateClusterRole calls Client.CreateClusterRole on the default client.
+func CreateClusterRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
+	return defaultClient().CreateClusterRole(context.Background(), typeMeta, objectMeta, rules)
+}
+
+// GetClusterRole calls Client.GetClusterRole on the default client.
+func GetClusterRole(name string) (*rbacv1.ClusterRole, error) {
+	return defaultClient().GetClusterRole(context.Background(), name)
+}
+
+// UpdateClusterRole calls Client.UpdateClusterRole on the default client.
+func UpdateClusterRole(objClusterRole *rbacv1.ClusterRole, rules []Rbacv1PolicyRule) error {
+	return defaultClient().UpdateClusterRole(context.Background(), objClusterRole, rules)
+}
+
+// ListClusterRole calls Client.ListClusterRole on the default client, without
+// list options.
+func ListClusterRole() (*rbacv1.ClusterRoleList, error) {
+	return defaultClient().ListClusterRole(context.Background(), ListOptions{})
+}
+
+// EachClusterRole calls Client.EachClusterRole on the default client.
+func EachClusterRole(listOptions ListOptions, fn func(*rbacv1.ClusterRole) error) error {
+	return defaultClient().EachClusterRole(context.Background(), listOptions, fn)
+}
+
+// WatchClusterRole calls Client.WatchClusterRole on the default client.
+func WatchClusterRole(listOptions ListOptions, fn func(ClusterRoleEvent) error) error {
+	return defaultClient().WatchClusterRole(context.Background(), listOptions, fn)
+}
+
+// DeleteClusterRole calls Client.DeleteClusterRole on the default client.
+func DeleteClusterRole(name string) error {
+	return defaultClient().DeleteClusterRole(context.Background(), name)
+}
+
+// CreateOrUpdateClusterRole calls Client.CreateOrUpdateClusterRole on the default client.
+func CreateOrUpdateClusterRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) (OperationResult, error) {
+	return defaultClient().CreateOrUpdateClusterRole(context.Background(), typeMeta, objectMeta, rules)
+}
+
+// ApplyClusterRole calls Client.ApplyClusterRole on the default client.
+func ApplyClusterRole(objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyClusterRole(context.Background(), objectMeta, rules, applyOptions)
+}
+
+// AddClusterRoleRules calls Client.AddClusterRoleRules on the default client.
+func AddClusterRoleRules(name string, rules []Rbacv1PolicyRule) error {
+	return defaultClient().AddClusterRoleRules(context.Background(), name, rules)
+}
+
+// RemoveClusterRoleRules calls Client.RemoveClusterRoleRules on the default client.
+func RemoveClusterRoleRules(name string, rules []Rbacv1PolicyRule) error {
+	return defaultClient().RemoveClusterRoleRules(context.Background(), name, rules)
 }
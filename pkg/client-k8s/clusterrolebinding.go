@@ -2,34 +2,25 @@ package clientk8s
 
 import (
 	"context"
-	"log"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
 )
 
-// CreateClusterRoleBinding ...
-func CreateClusterRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
-
-	context := context.Background()
+// GenerateClusterRoleBinding returns the cluster role binding
+// CreateClusterRoleBinding creates, without sending it to the API server.
+func GenerateClusterRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) *rbacv1.ClusterRoleBinding {
 
-	var subjectItems []rbacv1.Subject
+	subjectItems := subjectsFrom(subject)
 
-	for _, item := range subject {
-		subjectItems = append(subjectItems, rbacv1.Subject{
-			Kind:      item.Kind,
-			APIGroup:  item.APIGroup,
-			Name:      item.Name,
-			Namespace: item.Namespace,
-		})
-	}
-
-	clusterRoleBindingSpec := &rbacv1.ClusterRoleBinding{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta: typeMeta.withDefaults(KindClusterRoleBinding, "rbac.authorization.k8s.io/v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -44,25 +35,33 @@ func CreateClusterRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMe
 		},
 	}
 
-	_, err = k8sClientSet.RbacV1().ClusterRoleBindings().Create(context, clusterRoleBindingSpec, metav1.CreateOptions{})
+}
 
-	if err != nil {
-		log.Printf("Error creating cluster role binding: %v \n", err)
-		return err
-	}
+// CreateClusterRoleBinding creates the cluster role binding
+// GenerateClusterRoleBinding returns.
+func (c *Client) CreateClusterRoleBinding(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
 
-	return nil
+	clusterRoleBindingSpec := GenerateClusterRoleBinding(typeMeta, objectMeta, subject, roleRef)
+	c.labelOwner(clusterRoleBindingSpec)
+
+	return c.do(ctx, OpCreate, KindClusterRoleBinding, "", objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().ClusterRoleBindings().Create(ctx, clusterRoleBindingSpec, c.createOptions())
+		return err
+	})
 
 }
 
-func GetClusterRoleBinding(name string) (*rbacv1.ClusterRoleBinding, error) {
+func (c *Client) GetClusterRoleBinding(ctx context.Context, name string) (*rbacv1.ClusterRoleBinding, error) {
 
-	context := context.Background()
+	var result *rbacv1.ClusterRoleBinding
 
-	result, err := k8sClientSet.RbacV1().ClusterRoleBindings().Get(context, name, metav1.GetOptions{})
+	err := c.do(ctx, OpGet, KindClusterRoleBinding, "", name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().ClusterRoleBindings().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting cluster role binding: %v \n", err)
 		return nil, err
 	}
 
@@ -70,42 +69,32 @@ func GetClusterRoleBinding(name string) (*rbacv1.ClusterRoleBinding, error) {
 
 }
 
-func UpdateClusterRoleBinding(objClusterRoleBinding *rbacv1.ClusterRoleBinding, subject []Rbacv1Subject) error {
-
-	context := context.Background()
+func (c *Client) UpdateClusterRoleBinding(ctx context.Context, objClusterRoleBinding *rbacv1.ClusterRoleBinding, subject []Rbacv1Subject) error {
 
-	var subjectItems []rbacv1.Subject
+	c.labelOwner(objClusterRoleBinding)
 
-	for _, item := range subject {
-		subjectItems = append(subjectItems, rbacv1.Subject{
-			Kind:      item.Kind,
-			APIGroup:  item.APIGroup,
-			Name:      item.Name,
-			Namespace: item.Namespace,
-		})
-	}
+	subjectItems := subjectsFrom(subject)
 
 	objClusterRoleBinding.Subjects = subjectItems
 
-	_, err := k8sClientSet.RbacV1().ClusterRoleBindings().Update(context, objClusterRoleBinding, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating cluster role binding: %v \n", err)
+	return c.do(ctx, OpUpdate, KindClusterRoleBinding, "", objClusterRoleBinding.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().ClusterRoleBindings().Update(ctx, objClusterRoleBinding, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListClusterRoleBinding() (*rbacv1.ClusterRoleBindingList, error) {
+func (c *Client) ListClusterRoleBinding(ctx context.Context, listOptions ListOptions) (*rbacv1.ClusterRoleBindingList, error) {
 
-	context := context.Background()
+	var result *rbacv1.ClusterRoleBindingList
 
-	result, err := k8sClientSet.RbacV1().ClusterRoleBindings().List(context, metav1.ListOptions{})
+	err := c.do(ctx, OpList, KindClusterRoleBinding, "", "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().ClusterRoleBindings().List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list clusters role bindings: %v \n", err)
 		return nil, err
 	}
 
@@ -113,50 +102,199 @@ func ListClusterRoleBinding() (*rbacv1.ClusterRoleBindingList, error) {
 
 }
 
-func DeleteClusterRoleBinding(name string) error {
-
-	context := context.Background()
+// EachClusterRoleBinding calls fn for every cluster role binding matching
+// listOptions, fetching them page by page. It stops at the first error
+// returned by fn.
+func (c *Client) EachClusterRoleBinding(ctx context.Context, listOptions ListOptions, fn func(*rbacv1.ClusterRoleBinding) error) error {
+	return c.each(ctx, KindClusterRoleBinding, "", listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.RbacV1().ClusterRoleBindings().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*rbacv1.ClusterRoleBinding))
+	})
+}
 
-	deletePolicy := metav1.DeletePropagationForeground
+// ClusterRoleBindingEvent is a change of a cluster role binding reported by
+// WatchClusterRoleBinding.
+type ClusterRoleBindingEvent struct {
+	Type               EventType
+	ClusterRoleBinding *rbacv1.ClusterRoleBinding
+}
 
-	err := k8sClientSet.RbacV1().ClusterRoleBindings().Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+// WatchClusterRoleBinding calls fn for every change of the cluster role
+// bindings matching listOptions, until ctx is cancelled or fn returns an
+// error. It starts with an Added event per existing cluster role binding,
+// unless listOptions.ResourceVersion is set, and resumes from the last
+// resourceVersion when the connection drops.
+func (c *Client) WatchClusterRoleBinding(ctx context.Context, listOptions ListOptions, fn func(ClusterRoleBindingEvent) error) error {
+	return c.watch(ctx, KindClusterRoleBinding, "", listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.RbacV1().ClusterRoleBindings().List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.RbacV1().ClusterRoleBindings().Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(ClusterRoleBindingEvent{Type: eventType, ClusterRoleBinding: obj.(*rbacv1.ClusterRoleBinding)})
 	})
+}
 
-	if err != nil {
-		log.Printf("Error delete cluster role binding: %v \n", err)
-		return err
-	}
+func (c *Client) DeleteClusterRoleBinding(ctx context.Context, name string) error {
 
-	return nil
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindClusterRoleBinding, "", name, func(ctx context.Context) error {
+		return c.clientset.RbacV1().ClusterRoleBindings().Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdateClusterRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetClusterRoleBinding(objectMeta.Name)
-		if getErr != nil {
-			log.Printf("Error getting cluster role binding: %v \n", err)
-			// return err
+func (c *Client) CreateOrUpdateClusterRoleBinding(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) (OperationResult, error) {
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindClusterRoleBinding, "", objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetClusterRoleBinding(ctx, objectMeta.Name)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
 
-		if resultGet != nil {
-			err := UpdateClusterRoleBinding(resultGet, subject)
+		if getErr == nil {
+			if equality.Semantic.DeepEqual(resultGet.Subjects, subjectsFrom(subject)) && c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			err := c.UpdateClusterRoleBinding(ctx, resultGet, subject)
 			if err != nil {
-				log.Printf("Error updating cluster role binding: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
 		} else {
-			err := CreateClusterRoleBinding(typeMeta, objectMeta, subject, roleRef)
+			err := c.CreateClusterRoleBinding(ctx, typeMeta, objectMeta, subject, roleRef)
 			if err != nil {
-				log.Printf("Error creating cluster role binding: %v \n", err)
 				return err
 			}
+			result = OperationResultCreated
 		}
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
 	}
-	return nil
+	return result, nil
+}
+
+// ApplyClusterRoleBinding creates or updates the cluster role binding using
+// server-side apply, so only the fields given here are owned by the field
+// manager.
+func (c *Client) ApplyClusterRoleBinding(ctx context.Context, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef, applyOptions ApplyOptions) error {
+
+	clusterRoleBindingApply := rbacv1ac.ClusterRoleBinding(objectMeta.Name).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations).
+		WithSubjects(subjectApplyConfigurations(subject)...).
+		WithRoleRef(roleRefApplyConfiguration(roleRef))
+
+	labels, annotations, err := c.driftStamps(clusterRoleBindingApply)
+	if err != nil {
+		return newError(OpApply, KindClusterRoleBinding, "", objectMeta.Name, err)
+	}
+	clusterRoleBindingApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindClusterRoleBinding, "", objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().ClusterRoleBindings().Apply(ctx, clusterRoleBindingApply, c.applyOptions(applyOptions))
+		return applyError(KindClusterRoleBinding, "", objectMeta.Name, err)
+	})
+
+}
+
+// AddSubjectsToClusterRoleBinding appends the subjects not already bound,
+// keeping the subjects added by other writers.
+func (c *Client) AddSubjectsToClusterRoleBinding(ctx context.Context, name string, subject []Rbacv1Subject) error {
+	return c.patchClusterRoleBindingSubjects(ctx, name, func(current []rbacv1.Subject) []rbacv1.Subject {
+		return addSubjects(current, subject)
+	})
+}
+
+// RemoveSubjectsFromClusterRoleBinding removes the given subjects from the
+// cluster role binding.
+func (c *Client) RemoveSubjectsFromClusterRoleBinding(ctx context.Context, name string, subject []Rbacv1Subject) error {
+	return c.patchClusterRoleBindingSubjects(ctx, name, func(current []rbacv1.Subject) []rbacv1.Subject {
+		return removeSubjects(current, subject)
+	})
+}
+
+func (c *Client) patchClusterRoleBindingSubjects(ctx context.Context, name string, change func([]rbacv1.Subject) []rbacv1.Subject) error {
+	return c.retryOnConflict(ctx, OpPatch, KindClusterRoleBinding, "", name, func(ctx context.Context) error {
+		clusterRoleBinding, err := c.GetClusterRoleBinding(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		patch, err := mergePatchWithResourceVersion(clusterRoleBinding.ResourceVersion, map[string]interface{}{
+			"subjects": change(clusterRoleBinding.Subjects),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.Patch(ctx, KindClusterRoleBinding, name, "", types.MergePatchType, patch)
+	})
+}
+
+// CreateClusterRoleBinding calls Client.CreateClusterRoleBinding on the default client.
+func CreateClusterRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
+	return defaultClient().CreateClusterRoleBinding(context.Background(), typeMeta, objectMeta, subject, roleRef)
+}
+
+// GetClusterRoleBinding calls Client.GetClusterRoleBinding on the default client.
+func GetClusterRoleBinding(name string) (*rbacv1.ClusterRoleBinding, error) {
+	return defaultClient().GetClusterRoleBinding(context.Background(), name)
+}
+
+// UpdateClusterRoleBinding calls Client.UpdateClusterRoleBinding on the default client.
+func UpdateClusterRoleBinding(objClusterRoleBinding *rbacv1.ClusterRoleBinding, subject []Rbacv1Subject) error {
+	return defaultClient().UpdateClusterRoleBinding(context.Background(), objClusterRoleBinding, subject)
+}
+
+// ListClusterRoleBinding calls Client.ListClusterRoleBinding on the default client, without list options.
+func ListClusterRoleBinding() (*rbacv1.ClusterRoleBindingList, error) {
+	return defaultClient().ListClusterRoleBinding(context.Background(), ListOptions{})
+}
+
+// EachClusterRoleBinding calls Client.EachClusterRoleBinding on the default client.
+func EachClusterRoleBinding(listOptions ListOptions, fn func(*rbacv1.ClusterRoleBinding) error) error {
+	return defaultClient().EachClusterRoleBinding(context.Background(), listOptions, fn)
+}
+
+// WatchClusterRoleBinding calls Client.WatchClusterRoleBinding on the default client.
+func WatchClusterRoleBinding(listOptions ListOptions, fn func(ClusterRoleBindingEvent) error) error {
+	return defaultClient().WatchClusterRoleBinding(context.Background(), listOptions, fn)
+}
+
+// DeleteClusterRoleBinding calls Client.DeleteClusterRoleBinding on the default client.
+func DeleteClusterRoleBinding(name string) error {
+	return defaultClient().DeleteClusterRoleBinding(context.Background(), name)
+}
+
+// CreateOrUpdateClusterRoleBinding calls Client.CreateOrUpdateClusterRoleBinding on the default client.
+func CreateOrUpdateClusterRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) (OperationResult, error) {
+	return defaultClient().CreateOrUpdateClusterRoleBinding(context.Background(), typeMeta, objectMeta, subject, roleRef)
+}
+
+// ApplyClusterRoleBinding calls Client.ApplyClusterRoleBinding on the default client.
+func ApplyClusterRoleBinding(objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyClusterRoleBinding(context.Background(), objectMeta, subject, roleRef, applyOptions)
+}
+
+// AddSubjectsToClusterRoleBinding calls Client.AddSubjectsToClusterRoleBinding on the default client.
+func AddSubjectsToClusterRoleBinding(name string, subject []Rbacv1Subject) error {
+	return defaultClient().AddSubjectsToClusterRoleBinding(context.Background(), name, subject)
+}
+
+// RemoveSubjectsFromClusterRoleBinding calls Client.RemoveSubjectsFromClusterRoleBinding on the default client.
+func RemoveSubjectsFromClusterRoleBinding(name string, subject []Rbacv1Subject) error {
+	return defaultClient().RemoveSubjectsFromClusterRoleBinding(context.Background(), name, subject)
 }
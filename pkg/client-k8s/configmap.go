@@ -2,22 +2,24 @@ package clientk8s
 
 import (
 	"context"
-	"log"
+	"encoding/json"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 )
 
-func CreateConfigMap(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data map[string]string) error {
-
-	context := context.Background()
+// GenerateConfigMap returns the config map CreateConfigMap creates, without
+// sending it to the API server.
+func GenerateConfigMap(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data map[string]string) *v1.ConfigMap {
 
-	cmSpec := &v1.ConfigMap{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return &v1.ConfigMap{
+		TypeMeta: typeMeta.withDefaults(KindConfigMap, "v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -27,25 +29,35 @@ func CreateConfigMap(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data
 		Data: data,
 	}
 
-	_, err = k8sClientSet.CoreV1().ConfigMaps(objectMeta.Namespace).Create(context, cmSpec, metav1.CreateOptions{})
+}
 
-	if err != nil {
-		log.Printf("Error creating configmap: %v \n", err)
-		return err
-	}
+func (c *Client) CreateConfigMap(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data map[string]string) error {
 
-	return nil
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	cmSpec := GenerateConfigMap(typeMeta, objectMeta, data)
+	c.labelOwner(cmSpec)
+
+	return c.do(ctx, OpCreate, KindConfigMap, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().ConfigMaps(objectMeta.Namespace).Create(ctx, cmSpec, c.createOptions())
+		return err
+	})
 
 }
 
-func GetConfigMap(name, namespace string) (*v1.ConfigMap, error) {
+func (c *Client) GetConfigMap(ctx context.Context, name, namespace string) (*v1.ConfigMap, error) {
+
+	namespace = c.resolveNamespace(namespace)
 
-	context := context.Background()
+	var result *v1.ConfigMap
 
-	result, err := k8sClientSet.CoreV1().ConfigMaps(namespace).Get(context, name, metav1.GetOptions{})
+	err := c.do(ctx, OpGet, KindConfigMap, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting configmap: %v \n", err)
 		return nil, err
 	}
 
@@ -53,31 +65,33 @@ func GetConfigMap(name, namespace string) (*v1.ConfigMap, error) {
 
 }
 
-func UpdateConfigMap(objConfigMap *v1.ConfigMap, data map[string]string) error {
+func (c *Client) UpdateConfigMap(ctx context.Context, objConfigMap *v1.ConfigMap, data map[string]string) error {
 
-	context := context.Background()
+	objConfigMap.Namespace = c.resolveNamespace(objConfigMap.Namespace)
+	c.labelOwner(objConfigMap)
 
 	objConfigMap.Data = data
 
-	_, err := k8sClientSet.CoreV1().ConfigMaps(objConfigMap.ObjectMeta.Namespace).Update(context, objConfigMap, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating configMap: %v \n", err)
+	return c.do(ctx, OpUpdate, KindConfigMap, objConfigMap.Namespace, objConfigMap.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().ConfigMaps(objConfigMap.ObjectMeta.Namespace).Update(ctx, objConfigMap, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListConfigMap(namespace string) (*v1.ConfigMapList, error) {
+func (c *Client) ListConfigMap(ctx context.Context, namespace string, listOptions ListOptions) (*v1.ConfigMapList, error) {
+
+	namespace = c.resolveNamespace(namespace)
 
-	context := context.Background()
+	var result *v1.ConfigMapList
 
-	result, err := k8sClientSet.CoreV1().ConfigMaps(namespace).List(context, metav1.ListOptions{})
+	err := c.do(ctx, OpList, KindConfigMap, namespace, "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().ConfigMaps(listNamespace(namespace)).List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list configMaps: %v \n", err)
 		return nil, err
 	}
 
@@ -85,50 +99,205 @@ func ListConfigMap(namespace string) (*v1.ConfigMapList, error) {
 
 }
 
-func DeleteConfigMap(name, namespace string) error {
+// EachConfigMap calls fn for every config map matching listOptions, fetching
+// them page by page. It stops at the first error returned by fn.
+func (c *Client) EachConfigMap(ctx context.Context, namespace string, listOptions ListOptions, fn func(*v1.ConfigMap) error) error {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	deletePolicy := metav1.DeletePropagationForeground
+	return c.each(ctx, KindConfigMap, namespace, listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.CoreV1().ConfigMaps(listNamespace(namespace)).List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*v1.ConfigMap))
+	})
+
+}
+
+// ConfigMapEvent is a change of a config map reported by WatchConfigMap.
+type ConfigMapEvent struct {
+	Type      EventType
+	ConfigMap *v1.ConfigMap
+}
+
+// WatchConfigMap calls fn for every change of the config maps matching
+// listOptions, until ctx is cancelled or fn returns an error. It starts with
+// an Added event per existing config map, unless listOptions.ResourceVersion
+// is set, and resumes from the last resourceVersion when the connection drops.
+func (c *Client) WatchConfigMap(ctx context.Context, namespace string, listOptions ListOptions, fn func(ConfigMapEvent) error) error {
 
-	err := k8sClientSet.CoreV1().ConfigMaps(namespace).Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+	namespace = c.resolveNamespace(namespace)
+
+	return c.watch(ctx, KindConfigMap, namespace, listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.CoreV1().ConfigMaps(listNamespace(namespace)).List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.CoreV1().ConfigMaps(listNamespace(namespace)).Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(ConfigMapEvent{Type: eventType, ConfigMap: obj.(*v1.ConfigMap)})
 	})
 
-	if err != nil {
-		log.Printf("Error delete configMap: %v \n", err)
-		return err
-	}
+}
+
+func (c *Client) DeleteConfigMap(ctx context.Context, name, namespace string) error {
 
-	return nil
+	namespace = c.resolveNamespace(namespace)
+
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindConfigMap, namespace, name, func(ctx context.Context) error {
+		return c.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdateConfigMap(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data map[string]string) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetConfigMap(objectMeta.Name, objectMeta.Namespace)
-		if getErr != nil {
-			log.Printf("Error getting configMap: %v \n", err)
-			// return err
+func (c *Client) CreateOrUpdateConfigMap(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data map[string]string) (OperationResult, error) {
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindConfigMap, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetConfigMap(ctx, objectMeta.Name, objectMeta.Namespace)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
 
-		if resultGet != nil {
-			err := UpdateConfigMap(resultGet, data)
+		if getErr == nil {
+			if equality.Semantic.DeepEqual(resultGet.Data, data) && c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			err := c.UpdateConfigMap(ctx, resultGet, data)
 			if err != nil {
-				log.Printf("Error updating configMap: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
 		} else {
-			err := CreateConfigMap(typeMeta, objectMeta, data)
+			err := c.CreateConfigMap(ctx, typeMeta, objectMeta, data)
 			if err != nil {
-				log.Printf("Error creating configMap: %v \n", err)
 				return err
 			}
+			result = OperationResultCreated
 		}
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
+	}
+	return result, nil
+}
+
+// ApplyConfigMap creates or updates the configmap using server-side apply, so
+// only the fields given here are owned by the field manager.
+func (c *Client) ApplyConfigMap(ctx context.Context, objectMeta Metav1ObjectMeta, data map[string]string, applyOptions ApplyOptions) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	cmApply := corev1ac.ConfigMap(objectMeta.Name, objectMeta.Namespace).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations).
+		WithData(data)
+
+	labels, annotations, err := c.driftStamps(cmApply)
+	if err != nil {
+		return newError(OpApply, KindConfigMap, objectMeta.Namespace, objectMeta.Name, err)
+	}
+	cmApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindConfigMap, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().ConfigMaps(objectMeta.Namespace).Apply(ctx, cmApply, c.applyOptions(applyOptions))
+		return applyError(KindConfigMap, objectMeta.Namespace, objectMeta.Name, err)
+	})
+
+}
+
+// PatchConfigMapKeys adds or overwrites the given keys with a strategic merge
+// patch, leaving the other keys as they are.
+func (c *Client) PatchConfigMapKeys(ctx context.Context, name, namespace string, data map[string]string) error {
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": data,
+	})
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return c.Patch(ctx, KindConfigMap, name, namespace, types.StrategicMergePatchType, patch)
+
+}
+
+// RemoveConfigMapKeys removes the given keys with a JSON merge patch. Missing
+// keys are ignored.
+func (c *Client) RemoveConfigMapKeys(ctx context.Context, name, namespace string, keys []string) error {
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": nullValues(keys),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, KindConfigMap, name, namespace, types.MergePatchType, patch)
+
+}
+
+// CreateConfigMap calls Client.CreateConfigMap on the default client.
+func CreateConfigMap(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data map[string]string) error {
+	return defaultClient().CreateConfigMap(context.Background(), typeMeta, objectMeta, data)
+}
+
+// GetConfigMap calls Client.GetConfigMap on the default client.
+func GetConfigMap(name, namespace string) (*v1.ConfigMap, error) {
+	return defaultClient().GetConfigMap(context.Background(), name, namespace)
+}
+
+// UpdateConfigMap calls Client.UpdateConfigMap on the default client.
+func UpdateConfigMap(objConfigMap *v1.ConfigMap, data map[string]string) error {
+	return defaultClient().UpdateConfigMap(context.Background(), objConfigMap, data)
+}
+
+// ListConfigMap calls Client.ListConfigMap on the default client, without list
+// options.
+func ListConfigMap(namespace string) (*v1.ConfigMapList, error) {
+	return defaultClient().ListConfigMap(context.Background(), namespace, ListOptions{})
+}
+
+// EachConfigMap calls Client.EachConfigMap on the default client.
+func EachConfigMap(namespace string, listOptions ListOptions, fn func(*v1.ConfigMap) error) error {
+	return defaultClient().EachConfigMap(context.Background(), namespace, listOptions, fn)
+}
+
+// WatchConfigMap calls Client.WatchConfigMap on the default client.
+func WatchConfigMap(namespace string, listOptions ListOptions, fn func(ConfigMapEvent) error) error {
+	return defaultClient().WatchConfigMap(context.Background(), namespace, listOptions, fn)
+}
+
+// DeleteConfigMap calls Client.DeleteConfigMap on the default client.
+func DeleteConfigMap(name, namespace string) error {
+	return defaultClient().DeleteConfigMap(context.Background(), name, namespace)
+}
+
+// CreateOrUpdateConfigMap calls Client.CreateOrUpdateConfigMap on the default client.
+func CreateOrUpdateConfigMap(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, data map[string]string) (OperationResult, error) {
+	return defaultClient().CreateOrUpdateConfigMap(context.Background(), typeMeta, objectMeta, data)
+}
+
+// ApplyConfigMap calls Client.ApplyConfigMap on the default client.
+func ApplyConfigMap(objectMeta Metav1ObjectMeta, data map[string]string, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyConfigMap(context.Background(), objectMeta, data, applyOptions)
+}
+
+// PatchConfigMapKeys calls Client.PatchConfigMapKeys on the default client.
+func PatchConfigMapKeys(name, namespace string, data map[string]string) error {
+	return defaultClient().PatchConfigMapKeys(context.Background(), name, namespace, data)
+}
+
+// RemoveConfigMapKeys calls Client.RemoveConfigMapKeys on the default client.
+func RemoveConfigMapKeys(name, namespace string, keys []string) error {
+	return defaultClient().RemoveConfigMapKeys(context.Background(), name, namespace, keys)
 }
@@ -0,0 +1,316 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// reconcileRequeue is the result label of the reconciles asking to run again.
+const reconcileRequeue = "requeue"
+
+// ObjectKey identifies the object a reconcile is about.
+type ObjectKey struct {
+	Namespace string
+	Name      string
+}
+
+func (k ObjectKey) String() string {
+	if k.Namespace == "" {
+		return k.Name
+	}
+	return k.Namespace + "/" + k.Name
+}
+
+// Result tells the controller whether to reconcile the key again.
+type Result struct {
+	// Requeue reconciles the key again after the rate limiter delay.
+	Requeue bool
+	// RequeueAfter reconciles the key again after the given delay.
+	RequeueAfter time.Duration
+}
+
+// Reconciler makes the cluster match the desired state of the object
+// identified by key. It is called again with the same key when it returns an
+// error, after a delay growing with every failure, so it must be idempotent.
+type Reconciler interface {
+	Reconcile(ctx context.Context, key ObjectKey) (Result, error)
+}
+
+// ReconcilerFunc adapts a function to the Reconciler interface.
+type ReconcilerFunc func(ctx context.Context, key ObjectKey) (Result, error)
+
+// Reconcile calls f.
+func (f ReconcilerFunc) Reconcile(ctx context.Context, key ObjectKey) (Result, error) {
+	return f(ctx, key)
+}
+
+// ControllerOptions configures a Controller.
+type ControllerOptions struct {
+	// Name identifies the controller in the logs and metrics.
+	Name string
+	// Kind is the kind of the objects reconciled. Every change of one of
+	// them enqueues its key.
+	Kind string
+	// Namespace and LabelSelector restrict the objects watched, as in
+	// CacheOptions.
+	Namespace     string
+	LabelSelector string
+	// ResyncPeriod enqueues every object again periodically. Zero disables
+	// resyncs.
+	ResyncPeriod time.Duration
+	// Workers is the number of keys reconciled concurrently. Defaults to 1.
+	// A key is never reconciled by two workers at once.
+	Workers int
+	// RateLimiter delays the keys enqueued again after a failure. Defaults
+	// to workqueue.DefaultControllerRateLimiter.
+	RateLimiter workqueue.RateLimiter
+	// ShutdownTimeout is how long Run waits for the reconciles in progress
+	// when its context is cancelled, before cancelling them. Defaults to
+	// 30s.
+	ShutdownTimeout time.Duration
+}
+
+// Controller runs a Reconciler for every change of the objects of a kind. The
+// changes are read from shared informers, whose cache is available to the
+// reconciler through Client, and queued so that failed keys are retried with
+// a backoff.
+type Controller struct {
+	opts       ControllerOptions
+	cache      *CachedClient
+	queue      workqueue.RateLimitingInterface
+	reconciler Reconciler
+}
+
+// NewController returns a controller reconciling the objects of
+// opts.Kind. It does nothing until Run is called.
+func (c *Client) NewController(opts ControllerOptions, reconciler Reconciler) (*Controller, error) {
+
+	if opts.Name == "" {
+		return nil, errors.New("controller name is required")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.RateLimiter == nil {
+		opts.RateLimiter = workqueue.DefaultControllerRateLimiter()
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 30 * time.Second
+	}
+
+	cachedClient, err := c.NewCachedClient(CacheOptions{
+		Kinds:         []string{opts.Kind},
+		Namespace:     opts.Namespace,
+		LabelSelector: opts.LabelSelector,
+		ResyncPeriod:  opts.ResyncPeriod,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating controller %s: %w", opts.Name, err)
+	}
+
+	ctrl := &Controller{
+		opts:       opts,
+		cache:      cachedClient,
+		queue:      workqueue.NewNamedRateLimitingQueue(opts.RateLimiter, opts.Name),
+		reconciler: reconciler,
+	}
+
+	if err := ctrl.Watch(opts.Kind, func(obj interface{}) []ObjectKey {
+		key, ok := objectKeyOf(obj)
+		if !ok {
+			return nil
+		}
+		return []ObjectKey{key}
+	}); err != nil {
+		return nil, err
+	}
+
+	return ctrl, nil
+
+}
+
+// Client returns the client of the controller, reading the watched kinds from
+// its cache. Reconcilers use it to read the objects and write the objects
+// they manage.
+func (ctrl *Controller) Client() *CachedClient {
+	return ctrl.cache
+}
+
+// Watch enqueues the keys returned by mapFn for every change of an object of
+// kind, such as the key of the object owning it. The object is the typed
+// object, or a cache.DeletedFinalStateUnknown when its deletion was missed.
+// Watch must be called before Run.
+func (ctrl *Controller) Watch(kind string, mapFn func(obj interface{}) []ObjectKey) error {
+
+	informer, err := ctrl.cache.informer(kind)
+	if err != nil {
+		return fmt.Errorf("error watching %s in controller %s: %w", kind, ctrl.opts.Name, err)
+	}
+
+	enqueue := func(obj interface{}) {
+		for _, key := range mapFn(obj) {
+			ctrl.Enqueue(key)
+		}
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(_, obj interface{}) {
+			enqueue(obj)
+		},
+		DeleteFunc: enqueue,
+	})
+
+	return nil
+
+}
+
+// Enqueue schedules a reconcile of key.
+func (ctrl *Controller) Enqueue(key ObjectKey) {
+	ctrl.queue.Add(key)
+}
+
+// Run starts the informers, waits for their cache to sync and reconciles the
+// queued keys until ctx is cancelled. It then stops taking new keys and waits
+// up to ShutdownTimeout for the reconciles in progress, which run with a
+// context of their own, before cancelling them.
+func (ctrl *Controller) Run(ctx context.Context) error {
+
+	defer ctrl.queue.ShutDown()
+
+	logger := ctrl.cache.logger.WithValues("controller", ctrl.opts.Name)
+
+	ctrl.cache.Start(ctx)
+	if err := ctrl.cache.WaitForCacheSync(ctx); err != nil {
+		return fmt.Errorf("error starting controller %s: %w", ctrl.opts.Name, err)
+	}
+
+	logger.Info("Starting workers", "workers", ctrl.opts.Workers)
+
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	var wg sync.WaitGroup
+	for i := 0; i < ctrl.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctrl.processNextKey(ctx, workCtx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	logger.Info("Stopping workers")
+	ctrl.queue.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(ctrl.opts.ShutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		logger.Info("Cancelling the reconciles in progress", "timeout", ctrl.opts.ShutdownTimeout)
+		cancelWork()
+		<-done
+	}
+
+	return nil
+
+}
+
+// processNextKey reconciles the next key of the queue. It returns false once
+// the controller is stopping.
+func (ctrl *Controller) processNextKey(ctx, workCtx context.Context) bool {
+
+	item, shutdown := ctrl.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer ctrl.queue.Done(item)
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	key := item.(ObjectKey)
+	start := time.Now()
+
+	result, err := ctrl.reconcile(workCtx, key)
+
+	label := resultSuccess
+	switch {
+	case err != nil:
+		label = resultError
+		ctrl.queue.AddRateLimited(key)
+		ctrl.cache.logger.Error(err, "Reconcile failed", "controller", ctrl.opts.Name, "key", key.String(), "requeues", ctrl.queue.NumRequeues(key))
+	case result.RequeueAfter > 0:
+		label = reconcileRequeue
+		ctrl.queue.Forget(key)
+		ctrl.queue.AddAfter(key, result.RequeueAfter)
+	case result.Requeue:
+		label = reconcileRequeue
+		ctrl.queue.AddRateLimited(key)
+	default:
+		ctrl.queue.Forget(key)
+	}
+
+	duration := time.Since(start)
+	ctrl.cache.metrics.reconcile(ctrl.opts.Name, label, duration, ctrl.queue.Len())
+	ctrl.cache.logger.V(1).Info("Reconciled", "controller", ctrl.opts.Name, "key", key.String(), "result", label, "duration", duration)
+
+	return true
+
+}
+
+// reconcile calls the reconciler, turning a panic into an error so the key is
+// retried instead of crashing the process.
+func (ctrl *Controller) reconcile(ctx context.Context, key ObjectKey) (result Result, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic reconciling %s: %v", key, r)
+		}
+	}()
+
+	return ctrl.reconciler.Reconcile(ctx, key)
+
+}
+
+// objectKeyOf returns the key of a typed object or of a deleted one.
+func objectKeyOf(obj interface{}) (ObjectKey, bool) {
+
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		namespace, name, err := cache.SplitMetaNamespaceKey(deleted.Key)
+		if err != nil {
+			return ObjectKey{}, false
+		}
+		return ObjectKey{Namespace: namespace, Name: name}, true
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ObjectKey{}, false
+	}
+
+	return ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, true
+
+}
+
+// NewController calls Client.NewController on the default client.
+func NewController(opts ControllerOptions, reconciler Reconciler) (*Controller, error) {
+	return defaultClient().NewController(opts, reconciler)
+}
@@ -0,0 +1,221 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// startController runs a controller of the config maps of clientset with
+// reconciler, and returns a function stopping it and returning the error of
+// Run.
+func startController(t *testing.T, clientset *fake.Clientset, opts ControllerOptions, reconciler ReconcilerFunc) func() error {
+
+	t.Helper()
+
+	opts.Name = "test"
+	opts.Kind = KindConfigMap
+	opts.Namespace = "default"
+	if opts.RateLimiter == nil {
+		opts.RateLimiter = workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)
+	}
+
+	ctrl, err := NewClientFromClientset(clientset).NewController(opts, reconciler)
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ctrl.Run(ctx)
+	}()
+
+	stop := func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run() didn't return after the context was cancelled")
+			return nil
+		}
+	}
+	t.Cleanup(func() { cancel() })
+
+	return stop
+
+}
+
+// receive waits for the next key of keys.
+func receive(t *testing.T, keys <-chan ObjectKey) ObjectKey {
+
+	t.Helper()
+
+	select {
+	case key := <-keys:
+		return key
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reconcile")
+		return ObjectKey{}
+	}
+
+}
+
+func TestControllerReconcilesChanges(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(configMap("a", "1"))
+
+	keys := make(chan ObjectKey, 10)
+	stop := startController(t, clientset, ControllerOptions{}, func(ctx context.Context, key ObjectKey) (Result, error) {
+		keys <- key
+		return Result{}, nil
+	})
+
+	if key := receive(t, keys); key != (ObjectKey{Namespace: "default", Name: "a"}) {
+		t.Errorf("first reconcile of %s, want default/a", key)
+	}
+
+	if _, err := clientset.CoreV1().ConfigMaps("default").Create(context.Background(), configMap("b", ""), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if key := receive(t, keys); key != (ObjectKey{Namespace: "default", Name: "b"}) {
+		t.Errorf("reconcile after a create of %s, want default/b", key)
+	}
+
+	if err := stop(); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+
+}
+
+func TestControllerRequeues(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		reconcile func(attempt int) (Result, error)
+	}{
+		{"error", func(attempt int) (Result, error) {
+			return Result{}, errors.New("not yet")
+		}},
+		{"panic", func(attempt int) (Result, error) {
+			panic("not yet")
+		}},
+		{"requeue", func(attempt int) (Result, error) {
+			return Result{Requeue: true}, nil
+		}},
+		{"requeue after", func(attempt int) (Result, error) {
+			return Result{RequeueAfter: time.Millisecond}, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			attempts := make(chan int, 10)
+			var mu sync.Mutex
+			attempt := 0
+
+			stop := startController(t, fake.NewSimpleClientset(configMap("a", "1")), ControllerOptions{}, func(ctx context.Context, key ObjectKey) (Result, error) {
+				mu.Lock()
+				attempt++
+				current := attempt
+				mu.Unlock()
+				attempts <- current
+				if current < 3 {
+					return tt.reconcile(current)
+				}
+				return Result{}, nil
+			})
+
+			for want := 1; want <= 3; want++ {
+				select {
+				case got := <-attempts:
+					if got != want {
+						t.Fatalf("attempt %d, want %d", got, want)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("no reconcile %d", want)
+				}
+			}
+
+			// Done after the third attempt.
+			select {
+			case got := <-attempts:
+				t.Errorf("unexpected attempt %d", got)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			stop()
+
+		})
+	}
+
+}
+
+func TestControllerShutdown(t *testing.T) {
+
+	tests := []struct {
+		name string
+		// work is how long a reconcile takes unless cancelled.
+		work          time.Duration
+		wantCancelled bool
+	}{
+		{"waits for the reconciles in progress", 20 * time.Millisecond, false},
+		{"cancels them after the timeout", time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			started := make(chan struct{})
+			finished := make(chan bool, 1)
+
+			stop := startController(t, fake.NewSimpleClientset(configMap("a", "1")), ControllerOptions{ShutdownTimeout: 100 * time.Millisecond}, func(ctx context.Context, key ObjectKey) (Result, error) {
+				close(started)
+				select {
+				case <-time.After(tt.work):
+					finished <- false
+				case <-ctx.Done():
+					finished <- true
+				}
+				return Result{}, nil
+			})
+
+			<-started
+			start := time.Now()
+			if err := stop(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			select {
+			case cancelled := <-finished:
+				if cancelled != tt.wantCancelled {
+					t.Errorf("reconcile cancelled = %v, want %v", cancelled, tt.wantCancelled)
+				}
+			default:
+				t.Fatal("Run() returned before the reconcile in progress")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Run() took %s to stop", elapsed)
+			}
+
+		})
+	}
+
+}
+
+func TestControllerRequiresName(t *testing.T) {
+
+	_, err := NewClientFromClientset(fake.NewSimpleClientset()).NewController(ControllerOptions{Kind: KindConfigMap}, ReconcilerFunc(func(context.Context, ObjectKey) (Result, error) {
+		return Result{}, nil
+	}))
+	if err == nil {
+		t.Fatal("NewController() without a name returned no error")
+	}
+
+}
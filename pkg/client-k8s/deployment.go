@@ -1,31 +1,37 @@
 package clientk8s
 
 import (
-	"log"
+	"context"
 
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
 )
 
-func GenerateJSONDeployment(
+// GenerateDeployment returns a deployment running deploymentContainer, whose
+// pods are selected by the labels of objectMeta. A nil replicas leaves the
+// replicas unset, for an autoscaler to manage. Render it as a manifest with
+// RenderYAML or RenderJSON, or apply it with ApplyDeployment.
+func GenerateDeployment(
 	typeMeta Metav1TypeMeta,
 	objectMeta Metav1ObjectMeta,
 	deploymentContainer []DeploymentContainerStruct,
-	replicas int32,
+	replicas *int32,
 ) *appsv1.Deployment {
 
 	var containerList []apiv1.Container
-	var containerPortList []apiv1.ContainerPort
-	var envFromList []apiv1.EnvFromSource
-	var envList []apiv1.EnvVar
-	var volumenMountsList []apiv1.VolumeMount
-	var volumenDevicesList []apiv1.VolumeDevice
 
 	for _, item := range deploymentContainer {
 
+		var containerPortList []apiv1.ContainerPort
+		var envFromList []apiv1.EnvFromSource
+		var envList []apiv1.EnvVar
+		var volumenMountsList []apiv1.VolumeMount
+		var volumenDevicesList []apiv1.VolumeDevice
+
 		for _, itemPortList := range item.ContainerPorts {
 			containerPortList = append(containerPortList, apiv1.ContainerPort{
 				Name:          itemPortList.Name,
@@ -37,19 +43,24 @@ func GenerateJSONDeployment(
 		}
 
 		for _, itemEnvFromList := range item.ContainerEnvFrom {
-			envFromList = append(envFromList, apiv1.EnvFromSource{
+			envFrom := apiv1.EnvFromSource{
 				Prefix: itemEnvFromList.Prefix,
-				ConfigMapRef: &apiv1.ConfigMapEnvSource{
+			}
+			if itemEnvFromList.ConfigMapRef != "" {
+				envFrom.ConfigMapRef = &apiv1.ConfigMapEnvSource{
 					LocalObjectReference: v1.LocalObjectReference{
 						Name: itemEnvFromList.ConfigMapRef,
 					},
-				},
-				SecretRef: &v1.SecretEnvSource{
+				}
+			}
+			if itemEnvFromList.SecretRef != "" {
+				envFrom.SecretRef = &v1.SecretEnvSource{
 					LocalObjectReference: v1.LocalObjectReference{
 						Name: itemEnvFromList.SecretRef,
 					},
-				},
-			})
+				}
+			}
+			envFromList = append(envFromList, envFrom)
 		}
 
 		for _, itemEnvList := range item.ContainerEnvVar {
@@ -76,24 +87,24 @@ func GenerateJSONDeployment(
 		}
 
 		resources := v1.ResourceRequirements{}
-		if item.ContainerResource.resourcesLimitsCPU != "" || item.ContainerResource.resourcesLimitsMemory != "" {
+		if item.ContainerResource.ResourcesLimitsCPU != "" || item.ContainerResource.ResourcesLimitsMemory != "" {
 			resources.Limits = make(v1.ResourceList)
 		}
-		if item.ContainerResource.resourcesLimitsCPU != "" {
-			resources.Limits[v1.ResourceCPU] = resource.MustParse(item.ContainerResource.resourcesLimitsCPU)
+		if item.ContainerResource.ResourcesLimitsCPU != "" {
+			resources.Limits[v1.ResourceCPU] = resource.MustParse(item.ContainerResource.ResourcesLimitsCPU)
 		}
-		if item.ContainerResource.resourcesLimitsMemory != "" {
-			resources.Limits[v1.ResourceMemory] = resource.MustParse(item.ContainerResource.resourcesLimitsMemory)
+		if item.ContainerResource.ResourcesLimitsMemory != "" {
+			resources.Limits[v1.ResourceMemory] = resource.MustParse(item.ContainerResource.ResourcesLimitsMemory)
 		}
 
-		if item.ContainerResource.resourcesRequestsCPU != "" || item.ContainerResource.resourcesRequestsMemory != "" {
+		if item.ContainerResource.ResourcesRequestsCPU != "" || item.ContainerResource.ResourcesRequestsMemory != "" {
 			resources.Requests = make(v1.ResourceList)
 		}
-		if item.ContainerResource.resourcesRequestsCPU != "" {
-			resources.Requests[v1.ResourceCPU] = resource.MustParse(item.ContainerResource.resourcesRequestsCPU)
+		if item.ContainerResource.ResourcesRequestsCPU != "" {
+			resources.Requests[v1.ResourceCPU] = resource.MustParse(item.ContainerResource.ResourcesRequestsCPU)
 		}
-		if item.ContainerResource.resourcesRequestsMemory != "" {
-			resources.Requests[v1.ResourceMemory] = resource.MustParse(item.ContainerResource.resourcesRequestsMemory)
+		if item.ContainerResource.ResourcesRequestsMemory != "" {
+			resources.Requests[v1.ResourceMemory] = resource.MustParse(item.ContainerResource.ResourcesRequestsMemory)
 		}
 
 		containerList = append(containerList, apiv1.Container{
@@ -112,10 +123,7 @@ func GenerateJSONDeployment(
 	}
 
 	deployment := &appsv1.Deployment{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+		TypeMeta: typeMeta.withDefaults(KindDeployment, "apps/v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -123,7 +131,7 @@ func GenerateJSONDeployment(
 			Annotations: objectMeta.Annotations,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: &replicas,
+			Replicas: replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: objectMeta.Labels,
 			},
@@ -138,8 +146,54 @@ func GenerateJSONDeployment(
 		},
 	}
 
-	log.Println("DEPLOYMENT: ", deployment)
-
 	return deployment
 
 }
+
+// GenerateJSONDeployment returns the deployment of GenerateDeployment.
+//
+// Deprecated: use GenerateDeployment, and RenderJSON for its JSON manifest.
+func GenerateJSONDeployment(
+	typeMeta Metav1TypeMeta,
+	objectMeta Metav1ObjectMeta,
+	deploymentContainer []DeploymentContainerStruct,
+	replicas int32,
+) *appsv1.Deployment {
+	return GenerateDeployment(typeMeta, objectMeta, deploymentContainer, &replicas)
+}
+
+// ApplyDeployment creates or updates a deployment, usually built with
+// GenerateDeployment, using server-side apply. Fields the deployment
+// leaves empty, such as the replicas of a deployment generated with nil
+// replicas for an autoscaler, are not taken over by the field manager.
+func (c *Client) ApplyDeployment(ctx context.Context, deployment *appsv1.Deployment, applyOptions ApplyOptions) error {
+
+	namespace := c.resolveNamespace(deployment.Namespace)
+
+	deploymentApply := &appsv1ac.DeploymentApplyConfiguration{}
+
+	err := toApplyConfiguration(deployment, deploymentApply)
+	if err != nil {
+		return newError(OpApply, KindDeployment, namespace, deployment.Name, err)
+	}
+
+	deploymentApply.Status = nil
+	deploymentApply.WithKind("Deployment").WithAPIVersion("apps/v1").WithNamespace(namespace)
+
+	labels, annotations, err := c.driftStamps(deploymentApply)
+	if err != nil {
+		return newError(OpApply, KindDeployment, namespace, deployment.Name, err)
+	}
+	deploymentApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindDeployment, namespace, deployment.Name, func(ctx context.Context) error {
+		_, err := c.clientset.AppsV1().Deployments(namespace).Apply(ctx, deploymentApply, c.applyOptions(applyOptions))
+		return applyError(KindDeployment, namespace, deployment.Name, err)
+	})
+
+}
+
+// ApplyDeployment calls Client.ApplyDeployment on the default client.
+func ApplyDeployment(deployment *appsv1.Deployment, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyDeployment(context.Background(), deployment, applyOptions)
+}
@@ -0,0 +1,105 @@
+package clientk8s
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestApplyDeploymentWithoutReplicas(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset()
+	c := NewClientFromClientset(clientset, WithNamespace("apps"))
+
+	var applied appsv1.Deployment
+	var namespace string
+	clientset.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		namespace = action.GetNamespace()
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &applied); err != nil {
+			t.Fatalf("invalid patch: %v", err)
+		}
+		return true, &appsv1.Deployment{}, nil
+	})
+
+	deployment := GenerateDeployment(
+		Metav1TypeMeta{},
+		Metav1ObjectMeta{Name: "web", Labels: map[string]string{"app": "web"}},
+		[]DeploymentContainerStruct{{ContainerName: "web", ContainerImage: "nginx"}},
+		nil,
+	)
+
+	if err := c.ApplyDeployment(context.Background(), deployment, ApplyOptions{}); err != nil {
+		t.Fatalf("ApplyDeployment() error = %v", err)
+	}
+
+	if applied.Spec.Replicas != nil {
+		t.Errorf("applied replicas = %d, want none", *applied.Spec.Replicas)
+	}
+	if namespace != "apps" || applied.Namespace != "apps" {
+		t.Errorf("applied to namespace %q as %q, want apps", namespace, applied.Namespace)
+	}
+	if deployment.Namespace != "" {
+		t.Errorf("ApplyDeployment() changed the namespace of the deployment to %q", deployment.Namespace)
+	}
+
+}
+
+func TestGenerateDeploymentContainers(t *testing.T) {
+
+	deployment := GenerateDeployment(
+		Metav1TypeMeta{},
+		Metav1ObjectMeta{Name: "web", Labels: map[string]string{"app": "web"}},
+		[]DeploymentContainerStruct{
+			{
+				ContainerName:    "web",
+				ContainerImage:   "nginx",
+				ContainerPorts:   []ContainerPortStruct{{Name: "http", ContainerPort: 80}},
+				ContainerEnvFrom: []EnvFromSourceStruct{{ConfigMapRef: "settings"}},
+				ContainerResource: ResourceListStruct{
+					ResourcesLimitsMemory: "128Mi",
+					ResourcesRequestsCPU:  "100m",
+				},
+			},
+			{
+				ContainerName:    "sidecar",
+				ContainerImage:   "proxy",
+				ContainerEnvFrom: []EnvFromSourceStruct{{SecretRef: "token"}},
+			},
+		},
+		nil,
+	)
+
+	containers := deployment.Spec.Template.Spec.Containers
+	if len(containers) != 2 {
+		t.Fatalf("containers = %d, want 2", len(containers))
+	}
+
+	web, sidecar := containers[0], containers[1]
+
+	if len(web.Ports) != 1 || len(sidecar.Ports) != 0 {
+		t.Errorf("ports = %v and %v, want the port of web only", web.Ports, sidecar.Ports)
+	}
+
+	if len(web.EnvFrom) != 1 || web.EnvFrom[0].ConfigMapRef == nil || web.EnvFrom[0].SecretRef != nil {
+		t.Errorf("web envFrom = %+v, want the config map only", web.EnvFrom)
+	}
+	if len(sidecar.EnvFrom) != 1 || sidecar.EnvFrom[0].SecretRef == nil || sidecar.EnvFrom[0].ConfigMapRef != nil {
+		t.Errorf("sidecar envFrom = %+v, want the secret only", sidecar.EnvFrom)
+	}
+
+	if memory := web.Resources.Limits.Memory(); memory.String() != "128Mi" {
+		t.Errorf("web memory limit = %s, want 128Mi", memory)
+	}
+	if cpu := web.Resources.Requests.Cpu(); cpu.String() != "100m" {
+		t.Errorf("web cpu request = %s, want 100m", cpu)
+	}
+	if sidecar.Resources.Limits != nil || sidecar.Resources.Requests != nil {
+		t.Errorf("sidecar resources = %+v, want none", sidecar.Resources)
+	}
+
+}
@@ -0,0 +1,536 @@
+package clientk8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// DiffChangeType is the kind of change of a field.
+type DiffChangeType string
+
+// Kinds of changes reported by Diff.
+const (
+	DiffAdded   DiffChangeType = "added"
+	DiffRemoved DiffChangeType = "removed"
+	DiffChanged DiffChangeType = "changed"
+)
+
+// DiffChange is a field changed between the live and the desired object.
+type DiffChange struct {
+	// Path of the field, such as .data.key or .rules[0].verbs.
+	Path string         `json:"path"`
+	Type DiffChangeType `json:"type"`
+	// Live and Desired are the values of the field, nil when it is absent.
+	Live    interface{} `json:"live,omitempty"`
+	Desired interface{} `json:"desired,omitempty"`
+}
+
+// DiffResult is the difference between an object in the cluster and the
+// object it would become.
+type DiffResult struct {
+	GroupVersionKind schema.GroupVersionKind
+	Namespace        string
+	Name             string
+	// Live is the object in the cluster, nil when it doesn't exist yet.
+	Live *unstructured.Unstructured
+	// Desired is the object the API server would store.
+	Desired *unstructured.Unstructured
+	// Changes are the changed fields, sorted by path.
+	Changes []DiffChange
+}
+
+// HasChanges reports whether the object would change.
+func (d *DiffResult) HasChanges() bool {
+	return len(d.Changes) > 0
+}
+
+// Unified returns the changes as a unified diff of the YAML manifests, empty
+// when there are none.
+func (d *DiffResult) Unified() string {
+
+	name := d.Name
+	if d.Namespace != "" {
+		name = d.Namespace + "/" + d.Name
+	}
+
+	return unifiedDiff("live/"+d.GroupVersionKind.Kind+"/"+name, "desired/"+d.GroupVersionKind.Kind+"/"+name, yamlLines(d.Live), yamlLines(d.Desired))
+
+}
+
+// secretGroupKind is the kind whose values Diff redacts.
+var secretGroupKind = schema.GroupKind{Kind: KindSecret}
+
+// lastAppliedAnnotation holds the last manifest applied by kubectl, secret
+// values included.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Diff returns what would change if obj, a typed object such as the ones
+// returned by the Generate* functions or an unstructured one, was applied with
+// the Apply* functions. The object the API server would store is computed by
+// a server-side dry-run apply, so defaults and admission webhooks are taken
+// into account. The apply is forced, so fields owned by other managers are
+// reported as changed instead of conflicting. Fields set by other managers
+// and left out of obj, such as the data keys written by the CreateOrUpdate*
+// functions, are kept by an apply: use DiffUpdate to preview those functions.
+//
+// The status and the fields managed by the API server, such as the
+// resourceVersion, uid and managedFields, are ignored, as are the labels and
+// annotations the package stamps on the objects it applies: ManagedByLabel,
+// OwnerLabel and DesiredHashAnnotation. The values of secrets are redacted:
+// they show as "***", or "*** (before)" and "*** (after)" when they change.
+func (c *Client) Diff(ctx context.Context, obj runtime.Object, applyOptions ApplyOptions) (*DiffResult, error) {
+
+	u, resource, live, err := c.diffLive(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRunResource, err := c.DryRun().Resource(resource.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+
+	applyOptions.Force = true
+
+	desired, err := dryRunResource.Namespace(resource.namespace).Apply(ctx, u, applyOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffResult(resource, u.GetName(), live, desired)
+
+}
+
+// DiffUpdate returns what would change if the object was replaced with obj,
+// as the Update* and CreateOrUpdate* functions do, or created when it doesn't
+// exist. The fields of obj replace the live ones, so data keys, rules or
+// subjects left out of obj are reported as removed. The metadata of the live
+// object is kept, with the labels and annotations of obj added. The object
+// the API server would store is computed by a server-side dry-run update.
+// What is ignored and redacted is the same as for Diff.
+func (c *Client) DiffUpdate(ctx context.Context, obj runtime.Object) (*DiffResult, error) {
+
+	u, resource, live, err := c.diffLive(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRunResource, err := c.DryRun().Resource(resource.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+	dryRunResource = dryRunResource.Namespace(resource.namespace)
+
+	var desired *unstructured.Unstructured
+
+	if live == nil {
+		desired, err = dryRunResource.Create(ctx, u)
+	} else {
+		desired, err = dryRunResource.Update(ctx, replacedObject(live, u))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return diffResult(resource, u.GetName(), live, desired)
+
+}
+
+// diffLive returns obj as an unstructured object, its resource restricted to
+// its namespace and the live object, nil when it doesn't exist.
+func (c *Client) diffLive(ctx context.Context, obj runtime.Object) (*unstructured.Unstructured, *DynamicResource, *unstructured.Unstructured, error) {
+
+	u, resource, err := c.objectResource(obj)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	resource = resource.Namespace(resource.resolveNamespace(u.GetNamespace()))
+
+	live, err := resource.Get(ctx, u.GetName())
+	if err != nil && !IsNotFound(err) {
+		return nil, nil, nil, err
+	}
+
+	return u, resource, live, nil
+
+}
+
+// replacedObject returns live with the fields of desired, keeping the
+// metadata of live with the labels and annotations of desired added.
+func replacedObject(live, desired *unstructured.Unstructured) *unstructured.Unstructured {
+
+	replaced := desired.DeepCopy()
+	unstructured.RemoveNestedField(replaced.Object, "status")
+	replaced.Object["metadata"] = runtime.DeepCopyJSONValue(live.Object["metadata"])
+	replaced.SetManagedFields(nil)
+
+	replaced.SetLabels(mergeStrings(live.GetLabels(), desired.GetLabels()))
+	replaced.SetAnnotations(mergeStrings(live.GetAnnotations(), desired.GetAnnotations()))
+
+	return replaced
+
+}
+
+// diffResult compares the live object, nil when it doesn't exist, with the
+// object the API server would store.
+func diffResult(resource *DynamicResource, name string, live, desired *unstructured.Unstructured) (*DiffResult, error) {
+
+	result := &DiffResult{
+		GroupVersionKind: resource.GroupVersionKind(),
+		Namespace:        resource.namespace,
+		Name:             name,
+	}
+
+	var err error
+	if live != nil {
+		if result.Live, err = manifestObject(live); err != nil {
+			return nil, err
+		}
+	}
+	if result.Desired, err = manifestObject(desired); err != nil {
+		return nil, err
+	}
+
+	removeStamps(result.Live)
+	removeStamps(result.Desired)
+
+	if result.GroupVersionKind.GroupKind() == secretGroupKind {
+		redactSecrets(result.Live, result.Desired)
+	}
+
+	var liveContent map[string]interface{}
+	if result.Live != nil {
+		liveContent = result.Live.Object
+	}
+
+	result.Changes = diffValues("", liveContent, result.Desired.Object, nil)
+
+	return result, nil
+
+}
+
+// removeStamps removes the labels and annotations stamped by the package from
+// obj, which may be nil.
+func removeStamps(obj *unstructured.Unstructured) {
+
+	if obj == nil {
+		return
+	}
+
+	for field, keys := range map[string][]string{
+		"labels":      {ManagedByLabel, OwnerLabel},
+		"annotations": {DesiredHashAnnotation},
+	} {
+		for _, key := range keys {
+			unstructured.RemoveNestedField(obj.Object, "metadata", field, key)
+		}
+		if values, found, _ := unstructured.NestedMap(obj.Object, "metadata", field); found && len(values) == 0 {
+			unstructured.RemoveNestedField(obj.Object, "metadata", field)
+		}
+	}
+
+}
+
+// redactSecrets replaces the secret values of live and desired, which may be
+// nil, keeping whether they changed.
+func redactSecrets(live, desired *unstructured.Unstructured) {
+
+	liveValues := secretValues(live)
+	desiredValues := secretValues(desired)
+
+	for key, liveValue := range liveValues {
+		desiredValue, found := desiredValues[key]
+		switch {
+		case !found:
+			liveValues[key] = "***"
+		case reflect.DeepEqual(liveValue, desiredValue):
+			liveValues[key] = "***"
+			desiredValues[key] = "***"
+		default:
+			liveValues[key] = "*** (before)"
+			desiredValues[key] = "*** (after)"
+		}
+	}
+
+	for key := range desiredValues {
+		if _, found := liveValues[key]; !found {
+			desiredValues[key] = "***"
+		}
+	}
+
+	setSecretValues(live, liveValues)
+	setSecretValues(desired, desiredValues)
+
+}
+
+// secretValues returns the values of a secret, keyed by the path of their
+// field.
+func secretValues(obj *unstructured.Unstructured) map[string]interface{} {
+
+	values := map[string]interface{}{}
+	if obj == nil {
+		return values
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		data, _, _ := unstructured.NestedMap(obj.Object, field)
+		for key, value := range data {
+			values[field+"."+key] = value
+		}
+	}
+
+	if value, found := obj.GetAnnotations()[lastAppliedAnnotation]; found {
+		values["annotation"] = value
+	}
+
+	return values
+
+}
+
+func setSecretValues(obj *unstructured.Unstructured, values map[string]interface{}) {
+
+	if obj == nil {
+		return
+	}
+
+	for path, value := range values {
+		if path == "annotation" {
+			annotations := obj.GetAnnotations()
+			annotations[lastAppliedAnnotation] = value.(string)
+			obj.SetAnnotations(annotations)
+			continue
+		}
+		field := strings.SplitN(path, ".", 2)
+		_ = unstructured.SetNestedField(obj.Object, value, field[0], field[1])
+	}
+
+}
+
+// diffValues appends the changes between live and desired at path to changes.
+// Lists of the same length are compared item by item, others as a whole.
+func diffValues(path string, live, desired interface{}, changes []DiffChange) []DiffChange {
+
+	liveMap, liveIsMap := live.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if liveIsMap && desiredIsMap {
+		keys := map[string]bool{}
+		for key := range liveMap {
+			keys[key] = true
+		}
+		for key := range desiredMap {
+			keys[key] = true
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			changes = diffValues(fieldPath(path, key), liveMap[key], desiredMap[key], changes)
+		}
+		return changes
+	}
+
+	liveList, liveIsList := live.([]interface{})
+	desiredList, desiredIsList := desired.([]interface{})
+	if liveIsList && desiredIsList && len(liveList) == len(desiredList) {
+		for i := range liveList {
+			changes = diffValues(fmt.Sprintf("%s[%d]", path, i), liveList[i], desiredList[i], changes)
+		}
+		return changes
+	}
+
+	switch {
+	case reflect.DeepEqual(live, desired):
+		return changes
+	case live == nil:
+		return append(changes, DiffChange{Path: path, Type: DiffAdded, Desired: desired})
+	case desired == nil:
+		return append(changes, DiffChange{Path: path, Type: DiffRemoved, Live: live})
+	default:
+		return append(changes, DiffChange{Path: path, Type: DiffChanged, Live: live, Desired: desired})
+	}
+
+}
+
+// fieldPath returns the path of the field key of path, quoting the keys that
+// contain dots or slashes such as label names.
+func fieldPath(path, key string) string {
+
+	if strings.ContainsAny(key, "./") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+
+	return path + "." + key
+
+}
+
+// yamlLines returns the lines of the YAML manifest of obj, none when obj is
+// nil.
+func yamlLines(obj *unstructured.Unstructured) []string {
+
+	if obj == nil {
+		return nil
+	}
+
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	return strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+
+}
+
+// diffContext is the number of unchanged lines around the changes of a
+// unified diff.
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+	// from and to are the indexes of the line in each version, or of the
+	// next line when it is absent from the version.
+	from int
+	to   int
+}
+
+// unifiedDiff returns the unified diff between the lines from and to.
+func unifiedDiff(fromName, toName string, from, to []string) string {
+
+	lines := diffLines(from, to)
+
+	var out strings.Builder
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// The hunk extends while the next change is close enough to share
+		// its context.
+		last := i
+		for j := i; j < len(lines) && j-last <= 2*diffContext; j++ {
+			if lines[j].op != ' ' {
+				last = j
+			}
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := last + diffContext + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		fromCount, toCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.op != '+' {
+				fromCount++
+			}
+			if line.op != '-' {
+				toCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(lines[start].from, fromCount), hunkRange(lines[start].to, toCount))
+		for _, line := range lines[start:end] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				out.WriteString("\n")
+			}
+		}
+
+		i = end
+	}
+
+	return out.String()
+
+}
+
+func hunkRange(index, count int) string {
+
+	if count == 0 {
+		return fmt.Sprintf("%d,0", index)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", index+1)
+	}
+
+	return fmt.Sprintf("%d,%d", index+1, count)
+
+}
+
+// diffLines returns the lines of both versions, marked as removed, added or
+// unchanged along their longest common subsequence.
+func diffLines(from, to []string) []diffLine {
+
+	// common[i][j] is the length of the longest common subsequence of
+	// from[i:] and to[j:].
+	common := make([][]int, len(from)+1)
+	for i := range common {
+		common[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			switch {
+			case from[i] == to[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(from)+len(to))
+
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			lines = append(lines, diffLine{op: ' ', text: from[i], from: i, to: j})
+			i++
+			j++
+		case j == len(to) || (i < len(from) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, diffLine{op: '-', text: from[i], from: i, to: j})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', text: to[j], from: i, to: j})
+			j++
+		}
+	}
+
+	return lines
+
+}
+
+// Diff calls Client.Diff on the default client.
+func Diff(obj runtime.Object, applyOptions ApplyOptions) (*DiffResult, error) {
+	return defaultClient().Diff(context.Background(), obj, applyOptions)
+}
+
+// DiffUpdate calls Client.DiffUpdate on the default client.
+func DiffUpdate(obj runtime.Object) (*DiffResult, error) {
+	return defaultClient().DiffUpdate(context.Background(), obj)
+}
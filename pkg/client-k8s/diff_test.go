@@ -0,0 +1,91 @@
+package clientk8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiffRemoveStamps(t *testing.T) {
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetLabels(map[string]string{ManagedByLabel: DefaultFieldManager, OwnerLabel: "shop", "app": "web"})
+	obj.SetAnnotations(map[string]string{DesiredHashAnnotation: "0"})
+
+	removeStamps(obj)
+	removeStamps(nil)
+
+	if labels := obj.GetLabels(); len(labels) != 1 || labels["app"] != "web" {
+		t.Errorf("labels = %v, want only app", labels)
+	}
+	if _, found := obj.Object["metadata"].(map[string]interface{})["annotations"]; found {
+		t.Errorf("annotations = %v, want none", obj.GetAnnotations())
+	}
+
+}
+
+// newDynamicTestClient returns a client whose dynamic client is a fake one
+// serving the kinds of the package, holding objects.
+func newDynamicTestClient(objects ...runtime.Object) *Client {
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	listKinds := map[schema.GroupVersionResource]string{}
+
+	for _, gvk := range driftKinds {
+		scope := meta.RESTScopeNamespace
+		if isClusterScoped(gvk.Kind) {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		listKinds[gvr] = gvk.Kind + "List"
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+
+	return NewClientFromClientset(fake.NewSimpleClientset(), WithDynamicClient(dynamicClient), WithRESTMapper(mapper))
+
+}
+
+func TestDiffUpdate(t *testing.T) {
+
+	live, err := ToUnstructured(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Data:       map[string]string{"a": "1", "b": "2"},
+	})
+	if err != nil {
+		t.Fatalf("ToUnstructured() error = %v", err)
+	}
+	c := newDynamicTestClient(live)
+
+	result, err := c.DiffUpdate(context.Background(), GenerateConfigMap(Metav1TypeMeta{}, Metav1ObjectMeta{Name: "settings", Namespace: "default"}, map[string]string{"a": "1", "c": "3"}))
+	if err != nil {
+		t.Fatalf("DiffUpdate() error = %v", err)
+	}
+
+	want := []DiffChange{
+		{Path: ".data.b", Type: DiffRemoved, Live: "2"},
+		{Path: ".data.c", Type: DiffAdded, Desired: "3"},
+	}
+	if !reflect.DeepEqual(result.Changes, want) {
+		t.Errorf("changes = %+v, want %+v", result.Changes, want)
+	}
+
+	missing, err := c.DiffUpdate(context.Background(), GenerateConfigMap(Metav1TypeMeta{}, Metav1ObjectMeta{Name: "other", Namespace: "default"}, map[string]string{"a": "1"}))
+	if err != nil {
+		t.Fatalf("DiffUpdate() error = %v", err)
+	}
+	if missing.Live != nil || !missing.HasChanges() {
+		t.Errorf("DiffUpdate() of a missing object = %+v, want it created", missing)
+	}
+
+}
@@ -0,0 +1,648 @@
+package clientk8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ManagedByLabel marks the objects applied by the package, with
+	// DefaultFieldManager as value.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// DesiredHashAnnotation holds the hash of the desired state of the
+	// objects applied by the package, see DetectDrift.
+	DesiredHashAnnotation = "by-client-k8s/desired-hash"
+)
+
+// driftKinds are the kinds DetectDrift scans for managed objects, besides the
+// kinds of the desired objects.
+var driftKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: KindNamespace},
+	{Version: "v1", Kind: KindServiceAccount},
+	{Version: "v1", Kind: KindConfigMap},
+	{Version: "v1", Kind: KindSecret},
+	{Version: "v1", Kind: KindPersistentVolumeClaim},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: KindClusterRole},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: KindClusterRoleBinding},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: KindRole},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: KindRoleBinding},
+	{Group: "apps", Version: "v1", Kind: KindDeployment},
+}
+
+// DriftStatus is the state of an object found by DetectDrift.
+type DriftStatus string
+
+// States of the objects found by DetectDrift.
+const (
+	// DriftInSync objects match their desired state.
+	DriftInSync DriftStatus = "in-sync"
+	// DriftDrifted objects were changed since they were applied.
+	DriftDrifted DriftStatus = "drifted"
+	// DriftMissing objects are desired but don't exist.
+	DriftMissing DriftStatus = "missing"
+	// DriftExtra objects are managed by the package but not desired.
+	DriftExtra DriftStatus = "extra"
+	// DriftUnknown objects are managed by the package but were not applied
+	// with a desired hash, so there is nothing to compare them with.
+	DriftUnknown DriftStatus = "unknown"
+)
+
+// DriftItem is an object checked by DetectDrift.
+type DriftItem struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Namespace  string      `json:"namespace,omitempty"`
+	Name       string      `json:"name"`
+	Status     DriftStatus `json:"status"`
+	// Changes are the drifted fields, when the desired object is known.
+	// Secret values are redacted.
+	Changes []DiffChange `json:"changes,omitempty"`
+}
+
+func (i DriftItem) String() string {
+	return i.Kind + " " + i.qualifiedName()
+}
+
+func (i DriftItem) qualifiedName() string {
+	if i.Namespace == "" {
+		return i.Name
+	}
+	return i.Namespace + "/" + i.Name
+}
+
+// DriftReport is the result of DetectDrift.
+type DriftReport struct {
+	Namespace     string `json:"namespace,omitempty"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// Summary counts the items by status.
+	Summary map[DriftStatus]int `json:"summary"`
+	// Items are the objects checked, sorted by kind, namespace and name.
+	Items []DriftItem `json:"items"`
+}
+
+// HasDrift reports whether an object is drifted, missing or extra.
+func (r *DriftReport) HasDrift() bool {
+	return r.Summary[DriftDrifted]+r.Summary[DriftMissing]+r.Summary[DriftExtra] > 0
+}
+
+// JSON returns the report as indented JSON.
+func (r *DriftReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Text returns the report as a table of the objects that are not in sync,
+// with their drifted fields, followed by the summary.
+func (r *DriftReport) Text() string {
+
+	var out bytes.Buffer
+
+	w := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+	for _, item := range r.Items {
+		if item.Status == DriftInSync {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", item.Status, item.Kind, item.qualifiedName())
+		for _, change := range item.Changes {
+			fmt.Fprintf(w, "\t\t  %s %s\n", change.Type, change.Path)
+		}
+	}
+	w.Flush()
+
+	fmt.Fprintf(&out, "%d in sync, %d drifted, %d missing, %d extra, %d unknown\n",
+		r.Summary[DriftInSync], r.Summary[DriftDrifted], r.Summary[DriftMissing], r.Summary[DriftExtra], r.Summary[DriftUnknown])
+
+	return out.String()
+
+}
+
+// DetectDrift finds the objects changed by hand since the package applied
+// them. It scans the objects labelled with ManagedByLabel in namespace,
+// AllNamespaces included, that match selector, among the kinds of the package
+// and the kinds of desired.
+//
+// Without desired objects, the hash of every managed object is compared with
+// its DesiredHashAnnotation. The hash covers the fields owned by the field
+// manager that applied the annotation, whatever its ApplyOptions.FieldManager;
+// a field taken over by another manager, as kubectl edit does, counts as
+// drifted.
+//
+// With desired objects, such as the ones returned by the Generate* functions,
+// every desired object is compared field by field with the live one. The
+// fields it doesn't set, such as the ones defaulted by the API server, are
+// ignored. Missing desired objects are reported, and so are the managed
+// objects that are not desired.
+func (c *Client) DetectDrift(ctx context.Context, namespace, selector string, desired ...runtime.Object) (*DriftReport, error) {
+
+	report := &DriftReport{
+		Namespace:     namespace,
+		LabelSelector: selector,
+		Summary:       map[DriftStatus]int{},
+	}
+
+	managedSelector := ManagedByLabel + "=" + DefaultFieldManager
+	if selector != "" {
+		managedSelector = selector + "," + managedSelector
+	}
+
+	desiredObjects := map[string]*unstructured.Unstructured{}
+	kinds := append([]schema.GroupVersionKind{}, driftKinds...)
+
+	for _, obj := range desired {
+		u, resource, err := c.objectResource(obj)
+		if err != nil {
+			return nil, err
+		}
+		u = u.DeepCopy()
+		u.SetNamespace(resource.Namespace(namespace).resolveNamespace(u.GetNamespace()))
+		desiredObjects[driftKey(u)] = u
+		kinds = appendKind(kinds, resource.GroupVersionKind())
+	}
+
+	seen := map[string]bool{}
+
+	for _, gvk := range kinds {
+		resource, err := c.Resource(gvk)
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		list, err := resource.Namespace(namespace).List(ctx, ListOptions{LabelSelector: managedSelector})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range list.Items {
+			live := &list.Items[i]
+			key := driftKey(live)
+			seen[key] = true
+
+			switch want, found := desiredObjects[key]; {
+			case found:
+				report.add(compareDesired(live, want))
+			case len(desired) > 0:
+				report.add(driftItem(live, DriftExtra, nil))
+			default:
+				report.add(compareHash(live))
+			}
+		}
+	}
+
+	// Desired objects without the label, or outside of the selector.
+	for key, want := range desiredObjects {
+		if seen[key] {
+			continue
+		}
+
+		resource, err := c.Resource(want.GroupVersionKind())
+		if err != nil {
+			return nil, err
+		}
+
+		live, err := resource.Namespace(want.GetNamespace()).Get(ctx, want.GetName())
+		switch {
+		case IsNotFound(err):
+			report.add(driftItem(want, DriftMissing, nil))
+		case err != nil:
+			return nil, err
+		default:
+			report.add(compareDesired(live, want))
+		}
+	}
+
+	sort.Slice(report.Items, func(i, j int) bool {
+		a, b := report.Items[i], report.Items[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	return report, nil
+
+}
+
+func (r *DriftReport) add(item DriftItem) {
+	r.Items = append(r.Items, item)
+	r.Summary[item.Status]++
+}
+
+func driftItem(obj *unstructured.Unstructured, status DriftStatus, changes []DiffChange) DriftItem {
+	return DriftItem{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Status:     status,
+		Changes:    changes,
+	}
+}
+
+// driftKey identifies an object across the versions of its kind.
+func driftKey(obj *unstructured.Unstructured) string {
+	return obj.GroupVersionKind().GroupKind().String() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func appendKind(kinds []schema.GroupVersionKind, gvk schema.GroupVersionKind) []schema.GroupVersionKind {
+
+	for _, kind := range kinds {
+		if kind.GroupKind() == gvk.GroupKind() {
+			return kinds
+		}
+	}
+
+	return append(kinds, gvk)
+
+}
+
+// compareHash checks the fields of live owned by the field manager that
+// applied its desired hash against the hash.
+func compareHash(live *unstructured.Unstructured) DriftItem {
+
+	hash, found := live.GetAnnotations()[DesiredHashAnnotation]
+	if !found {
+		return driftItem(live, DriftUnknown, nil)
+	}
+
+	// The apply setting the hash owns the annotation. Without such an
+	// apply, the annotation was changed by another kind of request.
+	var fields map[string]interface{}
+	for _, entry := range live.GetManagedFields() {
+		if entry.Operation != metav1.ManagedFieldsOperationApply || entry.Subresource != "" || entry.FieldsV1 == nil {
+			continue
+		}
+		var entryFields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &entryFields); err != nil {
+			return driftItem(live, DriftUnknown, nil)
+		}
+		annotations, _, _ := unstructured.NestedMap(entryFields, "f:metadata", "f:annotations")
+		if _, found := annotations["f:"+DesiredHashAnnotation]; found {
+			fields = entryFields
+			break
+		}
+	}
+	if fields == nil {
+		return driftItem(live, DriftDrifted, nil)
+	}
+
+	// The API server stores the stringData of secrets into data, but the
+	// apply owns its fields as stringData.
+	if live.GroupVersionKind().GroupKind() == secretGroupKind {
+		fields = foldStringDataFields(fields)
+	}
+
+	owned, _ := ownedFields(fields, live.Object).(map[string]interface{})
+
+	liveHash, err := desiredHash(owned)
+	if err != nil || liveHash != hash {
+		return driftItem(live, DriftDrifted, nil)
+	}
+
+	return driftItem(live, DriftInSync, nil)
+
+}
+
+// compareDesired checks live against the fields set by want.
+func compareDesired(live, want *unstructured.Unstructured) DriftItem {
+
+	wantContent, err := hashContent(want.Object)
+	if err != nil {
+		return driftItem(live, DriftUnknown, nil)
+	}
+	liveContent, _ := projectDesired(live.Object, wantContent).(map[string]interface{})
+
+	if want.GroupVersionKind().GroupKind() == secretGroupKind {
+		redactSecrets(&unstructured.Unstructured{Object: liveContent}, &unstructured.Unstructured{Object: wantContent})
+	}
+
+	changes := diffValues("", liveContent, wantContent, nil)
+	if len(changes) > 0 {
+		return driftItem(live, DriftDrifted, changes)
+	}
+
+	return driftItem(live, DriftInSync, nil)
+
+}
+
+// projectDesired returns the fields of live that are set in want, so that the
+// fields defaulted by the API server are ignored. Lists of the same length
+// are projected item by item.
+func projectDesired(live, want interface{}) interface{} {
+
+	switch want := want.(type) {
+	case map[string]interface{}:
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		projected := map[string]interface{}{}
+		for key, value := range want {
+			if liveValue, found := liveMap[key]; found {
+				projected[key] = projectDesired(liveValue, value)
+			}
+		}
+		return projected
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok || len(liveList) != len(want) {
+			return live
+		}
+		projected := make([]interface{}, len(liveList))
+		for i := range liveList {
+			projected[i] = projectDesired(liveList[i], want[i])
+		}
+		return projected
+	default:
+		return live
+	}
+
+}
+
+// ownedFields returns the values of live at the fields of a managedFields
+// entry, in the FieldsV1 format.
+func ownedFields(fields map[string]interface{}, live interface{}) interface{} {
+
+	switch live := live.(type) {
+	case map[string]interface{}:
+		owned := map[string]interface{}{}
+		for key, children := range fields {
+			if !strings.HasPrefix(key, "f:") {
+				continue
+			}
+			name := strings.TrimPrefix(key, "f:")
+			value, found := live[name]
+			if !found {
+				continue
+			}
+			owned[name] = ownedChildren(children, value)
+		}
+		return owned
+	case []interface{}:
+		var owned []interface{}
+		for i, item := range live {
+			for key, children := range fields {
+				if ownedItem(key, i, item) {
+					owned = append(owned, ownedChildren(children, item))
+					break
+				}
+			}
+		}
+		return owned
+	default:
+		return live
+	}
+
+}
+
+// ownedChildren returns value, restricted to children when they are fields
+// of its own.
+func ownedChildren(children interface{}, value interface{}) interface{} {
+
+	childFields, _ := children.(map[string]interface{})
+	for key := range childFields {
+		if key != "." {
+			return ownedFields(childFields, value)
+		}
+	}
+
+	return value
+
+}
+
+// ownedItem reports whether the list item at index is the one designated by
+// the FieldsV1 key, by its key fields (k:), value (v:) or index (i:).
+func ownedItem(key string, index int, item interface{}) bool {
+
+	switch {
+	case strings.HasPrefix(key, "k:"):
+		var keys map[string]interface{}
+		itemMap, ok := item.(map[string]interface{})
+		if !ok || json.Unmarshal([]byte(strings.TrimPrefix(key, "k:")), &keys) != nil {
+			return false
+		}
+		for name, value := range keys {
+			if !sameJSON(itemMap[name], value) {
+				return false
+			}
+		}
+		return true
+	case strings.HasPrefix(key, "v:"):
+		var value interface{}
+		if json.Unmarshal([]byte(strings.TrimPrefix(key, "v:")), &value) != nil {
+			return false
+		}
+		return sameJSON(item, value)
+	case strings.HasPrefix(key, "i:"):
+		return key == fmt.Sprintf("i:%d", index)
+	default:
+		return false
+	}
+
+}
+
+// sameJSON compares two values by their JSON encoding, as numbers decode to
+// int64 in unstructured objects and to float64 otherwise.
+func sameJSON(a, b interface{}) bool {
+
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+
+}
+
+// driftStamps returns the labels and annotation stamping the apply
+// configuration or unstructured object desired for DetectDrift, along with
+// the owner label of the client.
+func (c *Client) driftStamps(desired interface{}) (labels, annotations map[string]string, err error) {
+
+	data, err := json.Marshal(desired)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var content map[string]interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, nil, err
+	}
+
+	labels = mergeStrings(map[string]string{ManagedByLabel: DefaultFieldManager}, c.ownerLabels())
+	for key, value := range labels {
+		if err := unstructured.SetNestedField(content, value, "metadata", "labels", key); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	hash, err := desiredHash(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return labels, map[string]string{DesiredHashAnnotation: hash}, nil
+
+}
+
+// desiredHash returns the hash of the desired state of an object.
+func desiredHash(content map[string]interface{}) (string, error) {
+
+	content, err := hashContent(content)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+
+}
+
+// hashContent returns the desired state of an object: its fields, with its
+// labels and annotations as only metadata. The type, the status and the
+// desired hash are left out, as are null fields. The stringData of secrets is
+// folded into their data, as the API server does. The nested values of
+// content are shared.
+func hashContent(content map[string]interface{}) (map[string]interface{}, error) {
+
+	content = copyValues(content)
+
+	if content["kind"] == KindSecret && content["apiVersion"] == "v1" {
+		if err := foldStringData(content); err != nil {
+			return nil, err
+		}
+	}
+
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	delete(content, "status")
+
+	metadata := map[string]interface{}{}
+	for _, field := range []string{"labels", "annotations"} {
+		values, _, err := unstructured.NestedMap(content, "metadata", field)
+		if err != nil {
+			return nil, err
+		}
+		delete(values, DesiredHashAnnotation)
+		if len(values) > 0 {
+			metadata[field] = values
+		}
+	}
+
+	delete(content, "metadata")
+	if len(metadata) > 0 {
+		content["metadata"] = metadata
+	}
+
+	pruneNulls(content)
+
+	return content, nil
+
+}
+
+// foldStringData moves the stringData of the secret content into its data,
+// base64 encoded, replacing the data of the same keys as the API server does.
+// The data of content is copied.
+func foldStringData(content map[string]interface{}) error {
+
+	stringData, found, err := unstructured.NestedStringMap(content, "stringData")
+	if err != nil || !found {
+		return err
+	}
+
+	data, _, err := unstructured.NestedMap(content, "data")
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	delete(content, "stringData")
+	if len(data) > 0 {
+		content["data"] = data
+	}
+
+	return nil
+
+}
+
+// foldStringDataFields moves the stringData fields of a managedFields entry
+// of a secret into its data fields. fields is left as it is.
+func foldStringDataFields(fields map[string]interface{}) map[string]interface{} {
+
+	stringData, ok := fields["f:stringData"].(map[string]interface{})
+	if !ok {
+		return fields
+	}
+
+	fields = copyValues(fields)
+	delete(fields, "f:stringData")
+
+	data, _ := fields["f:data"].(map[string]interface{})
+	data = copyValues(data)
+	for key, value := range stringData {
+		data[key] = value
+	}
+	fields["f:data"] = data
+
+	return fields
+
+}
+
+// copyValues returns a shallow copy of content.
+func copyValues(content map[string]interface{}) map[string]interface{} {
+
+	copied := make(map[string]interface{}, len(content))
+	for key, value := range content {
+		copied[key] = value
+	}
+
+	return copied
+
+}
+
+// mergeStrings returns the values of a with those of b.
+func mergeStrings(a, b map[string]string) map[string]string {
+
+	merged := make(map[string]string, len(a)+len(b))
+	for key, value := range a {
+		merged[key] = value
+	}
+	for key, value := range b {
+		merged[key] = value
+	}
+
+	return merged
+
+}
+
+// DetectDrift calls Client.DetectDrift on the default client.
+func DetectDrift(namespace, selector string, desired ...runtime.Object) (*DriftReport, error) {
+	return defaultClient().DetectDrift(context.Background(), namespace, selector, desired...)
+}
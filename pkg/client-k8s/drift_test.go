@@ -0,0 +1,107 @@
+package clientk8s
+
+import (
+	"encoding/base64"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// appliedSecret returns the secret the API server stores for an apply of the
+// password as stringData by manager, stamped with labels and annotations.
+func appliedSecret(t *testing.T, manager, password string, labels, annotations map[string]string) *unstructured.Unstructured {
+
+	t.Helper()
+
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       KindSecret,
+		"data": map[string]interface{}{
+			"password": base64.StdEncoding.EncodeToString([]byte(password)),
+		},
+		"type": string(v1.SecretTypeOpaque),
+	}}
+	live.SetName("token")
+	live.SetNamespace("default")
+	live.SetLabels(labels)
+	live.SetAnnotations(annotations)
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:    manager,
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1: &metav1.FieldsV1{Raw: []byte(`{
+			"f:metadata": {
+				"f:labels": {"f:app.kubernetes.io/managed-by": {}},
+				"f:annotations": {"f:by-client-k8s/desired-hash": {}}
+			},
+			"f:stringData": {"f:password": {}}
+		}`)},
+	}})
+
+	return live
+
+}
+
+func TestDriftSecretStringData(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+
+	labels, annotations, err := c.driftStamps(corev1ac.Secret("token", "default").
+		WithStringData(map[string]string{"password": "s3cret"}))
+	if err != nil {
+		t.Fatalf("driftStamps() error = %v", err)
+	}
+
+	// Applied with a field manager of its own.
+	live := appliedSecret(t, "deployer", "s3cret", labels, annotations)
+
+	if item := compareHash(live); item.Status != DriftInSync {
+		t.Errorf("compareHash() = %s, want %s", item.Status, DriftInSync)
+	}
+
+	want, err := ToUnstructured(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+		StringData: map[string]string{"password": "s3cret"},
+	})
+	if err != nil {
+		t.Fatalf("ToUnstructured() error = %v", err)
+	}
+	if item := compareDesired(live, want); item.Status != DriftInSync {
+		t.Errorf("compareDesired() = %s %v, want %s", item.Status, item.Changes, DriftInSync)
+	}
+
+	changed := appliedSecret(t, "deployer", "changed", labels, annotations)
+
+	if item := compareHash(changed); item.Status != DriftDrifted {
+		t.Errorf("compareHash() of a changed secret = %s, want %s", item.Status, DriftDrifted)
+	}
+	item := compareDesired(changed, want)
+	if item.Status != DriftDrifted || len(item.Changes) != 1 || item.Changes[0].Path != ".data.password" {
+		t.Errorf("compareDesired() of a changed secret = %s %v, want a change of .data.password", item.Status, item.Changes)
+	}
+
+}
+
+func TestDriftHashNotApplied(t *testing.T) {
+
+	live := appliedSecret(t, "deployer", "s3cret", nil, nil)
+	if item := compareHash(live); item.Status != DriftUnknown {
+		t.Errorf("compareHash() without a hash = %s, want %s", item.Status, DriftUnknown)
+	}
+
+	// The hash annotation was last written by an update, not an apply.
+	live.SetAnnotations(map[string]string{DesiredHashAnnotation: "0"})
+	entries := live.GetManagedFields()
+	entries[0].Operation = metav1.ManagedFieldsOperationUpdate
+	live.SetManagedFields(entries)
+
+	if item := compareHash(live); item.Status != DriftDrifted {
+		t.Errorf("compareHash() of an updated hash = %s, want %s", item.Status, DriftDrifted)
+	}
+
+}
@@ -0,0 +1,111 @@
+package clientk8s
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// Values of Metav1CreateOptions.FieldValidation.
+const (
+	FieldValidationStrict = metav1.FieldValidationStrict
+	FieldValidationWarn   = metav1.FieldValidationWarn
+	FieldValidationIgnore = metav1.FieldValidationIgnore
+)
+
+// WithDryRun sends every create, update, patch, apply and delete request as a
+// server-side dry-run: the API server validates the request and runs the
+// admission webhooks, but persists nothing. Use Client.DryRun for a single
+// call.
+func WithDryRun() Option {
+	return func(c *Client) {
+		c.dryRun = true
+	}
+}
+
+// WithCreateOptions sets the options of the create, update and patch
+// requests. The field validation of the API server is used when
+// FieldValidation is empty.
+func WithCreateOptions(createOptions Metav1CreateOptions) Option {
+	return func(c *Client) {
+		c.fieldValidation = createOptions.FieldValidation
+	}
+}
+
+// WithWarningHandler sets the function receiving the warnings returned by the
+// API server, such as the deprecation of an API version or the unknown fields
+// under FieldValidationWarn. The default handler logs them.
+func WithWarningHandler(handler func(warning string)) Option {
+	return func(c *Client) {
+		c.warningHandler = handler
+	}
+}
+
+// DryRun returns a copy of the client sending its mutating requests as a
+// server-side dry-run, as WithDryRun does. The copy shares everything else
+// with c.
+func (c *Client) DryRun() *Client {
+	clone := *c
+	clone.dryRun = true
+	return &clone
+}
+
+func (c *Client) dryRunOption() []string {
+	if !c.dryRun {
+		return nil
+	}
+	return []string{metav1.DryRunAll}
+}
+
+func (c *Client) createOptions() metav1.CreateOptions {
+	return metav1.CreateOptions{
+		DryRun:          c.dryRunOption(),
+		FieldValidation: c.fieldValidation,
+	}
+}
+
+func (c *Client) updateOptions() metav1.UpdateOptions {
+	return metav1.UpdateOptions{
+		DryRun:          c.dryRunOption(),
+		FieldValidation: c.fieldValidation,
+	}
+}
+
+func (c *Client) patchOptions() metav1.PatchOptions {
+	return metav1.PatchOptions{
+		DryRun:          c.dryRunOption(),
+		FieldValidation: c.fieldValidation,
+	}
+}
+
+func (c *Client) applyOptions(applyOptions ApplyOptions) metav1.ApplyOptions {
+	opts := applyOptions.metav1()
+	opts.DryRun = c.dryRunOption()
+	return opts
+}
+
+// configureWarnings sends the warnings of the API server to the warning
+// handler.
+func (c *Client) configureWarnings(config *rest.Config) {
+	config.WarningHandler = warningHandler{client: c}
+}
+
+// warningHandler passes the warnings of the API server to the client.
+type warningHandler struct {
+	client *Client
+}
+
+func (h warningHandler) HandleWarningHeader(code int, agent string, message string) {
+
+	// Only 299 warnings are sent by the API server.
+	if code != 299 || message == "" {
+		return
+	}
+
+	if h.client.warningHandler != nil {
+		h.client.warningHandler(message)
+		return
+	}
+
+	h.client.logger.Info("Warning from the API server", "warning", message)
+
+}
@@ -0,0 +1,108 @@
+package clientk8s
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDryRunOptions(t *testing.T) {
+
+	dryRun := []string{metav1.DryRunAll}
+
+	tests := []struct {
+		name            string
+		client          *Client
+		dryRun          []string
+		fieldValidation string
+	}{
+		{"default", NewClientFromClientset(fake.NewSimpleClientset()), nil, ""},
+		{"option", NewClientFromClientset(fake.NewSimpleClientset(), WithDryRun(), WithCreateOptions(Metav1CreateOptions{FieldValidation: FieldValidationStrict})), dryRun, FieldValidationStrict},
+		{"copy", NewClientFromClientset(fake.NewSimpleClientset(), WithCreateOptions(Metav1CreateOptions{FieldValidation: FieldValidationWarn})).DryRun(), dryRun, FieldValidationWarn},
+	}
+	for _, tt := range tests {
+		c := tt.client
+
+		if opts := c.createOptions(); !reflect.DeepEqual(opts.DryRun, tt.dryRun) || opts.FieldValidation != tt.fieldValidation {
+			t.Errorf("%s: create options = %+v", tt.name, opts)
+		}
+		if opts := c.updateOptions(); !reflect.DeepEqual(opts.DryRun, tt.dryRun) || opts.FieldValidation != tt.fieldValidation {
+			t.Errorf("%s: update options = %+v", tt.name, opts)
+		}
+		if opts := c.patchOptions(); !reflect.DeepEqual(opts.DryRun, tt.dryRun) || opts.FieldValidation != tt.fieldValidation {
+			t.Errorf("%s: patch options = %+v", tt.name, opts)
+		}
+		if opts := c.applyOptions(ApplyOptions{Force: true}); !reflect.DeepEqual(opts.DryRun, tt.dryRun) || !opts.Force || opts.FieldManager != DefaultFieldManager {
+			t.Errorf("%s: apply options = %+v", tt.name, opts)
+		}
+	}
+
+}
+
+func TestDryRunDelete(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(configMap("settings", "1"))
+	// The fake clientset ignores the dry-runs, unlike the API server.
+	clientset.PrependReactor("delete", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return len(action.(k8stesting.DeleteAction).GetDeleteOptions().DryRun) > 0, nil, nil
+	})
+	c := NewClientFromClientset(clientset)
+	ctx := context.Background()
+
+	if err := c.DryRun().DeleteConfigMap(ctx, "settings", "default"); err != nil {
+		t.Fatalf("DeleteConfigMap() error = %v", err)
+	}
+	if err := c.DeleteConfigMap(ctx, "settings", "default"); err != nil {
+		t.Fatalf("DeleteConfigMap() error = %v", err)
+	}
+
+	var dryRuns [][]string
+	for _, action := range clientset.Actions() {
+		if deleteAction, ok := action.(k8stesting.DeleteAction); ok {
+			dryRuns = append(dryRuns, deleteAction.GetDeleteOptions().DryRun)
+		}
+	}
+
+	// Only the copy sends dry-runs.
+	if want := [][]string{{metav1.DryRunAll}, nil}; !reflect.DeepEqual(dryRuns, want) {
+		t.Errorf("delete dry-runs = %v, want %v", dryRuns, want)
+	}
+
+}
+
+func TestWarningHandler(t *testing.T) {
+
+	var warnings []string
+	c := NewClientFromClientset(fake.NewSimpleClientset(), WithWarningHandler(func(warning string) {
+		warnings = append(warnings, warning)
+	}))
+
+	handler := warningHandler{client: c}
+	handler.HandleWarningHeader(299, "", "v1beta1 is deprecated")
+	handler.HandleWarningHeader(199, "", "not from the API server")
+	handler.HandleWarningHeader(299, "", "")
+
+	if want := []string{"v1beta1 is deprecated"}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %v, want %v", warnings, want)
+	}
+
+	// Logged without a handler.
+	var logged []string
+	logger := funcr.New(func(prefix, args string) {
+		logged = append(logged, args)
+	}, funcr.Options{})
+
+	warningHandler{client: NewClientFromClientset(fake.NewSimpleClientset(), WithLogger(logger))}.HandleWarningHeader(299, "", "unknown field")
+
+	if len(logged) != 1 || !strings.Contains(logged[0], "unknown field") {
+		t.Errorf("logged %v, want the warning", logged)
+	}
+
+}
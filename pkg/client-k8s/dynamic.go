@@ -0,0 +1,580 @@
+package clientk8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+)
+
+// WithDynamicClient sets the client used by NewClientFromClientset for the
+// resources the package has no typed functions for, such as the fake dynamic
+// client in tests. NewClient creates one from the config.
+func WithDynamicClient(dynamicClient dynamic.Interface) Option {
+	return func(c *Client) {
+		c.dynamicClient = dynamicClient
+	}
+}
+
+// WithRESTMapper sets the mapper from kinds to resources. Defaults to a
+// mapper reading the API groups of the server through discovery, refreshed
+// when a kind is missing.
+func WithRESTMapper(restMapper meta.RESTMapper) Option {
+	return func(c *Client) {
+		c.restMapper = restMapper
+	}
+}
+
+// setClientset sets the clientset and the mapper discovering its resources.
+func (c *Client) setClientset(clientset kubernetes.Interface) {
+
+	c.clientset = clientset
+
+	if c.restMapper == nil {
+		c.restMapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+	}
+
+}
+
+// DynamicResource reads and writes the objects of any resource served by the
+// API server, such as custom resources, as unstructured objects. The requests
+// are logged, traced and retried like those of the typed functions.
+type DynamicResource struct {
+	client    *Client
+	mapping   *meta.RESTMapping
+	namespace string
+}
+
+// UnstructuredEvent is a change of an object reported by
+// DynamicResource.Watch.
+type UnstructuredEvent struct {
+	Type   EventType
+	Object *unstructured.Unstructured
+}
+
+// Resource returns the resource serving the objects of gvk, found through
+// discovery.
+func (c *Client) Resource(gvk schema.GroupVersionKind) (*DynamicResource, error) {
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.dynamicClient == nil {
+		return nil, errors.New("the dynamic client is not available, create the client with NewClient or WithDynamicClient")
+	}
+
+	mapping, err := c.restMapping(func() (*meta.RESTMapping, error) {
+		return c.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error mapping %s: %w", gvk, err)
+	}
+
+	return &DynamicResource{client: c, mapping: mapping}, nil
+
+}
+
+// ResourceForGVR returns the resource gvr, found through discovery.
+func (c *Client) ResourceForGVR(gvr schema.GroupVersionResource) (*DynamicResource, error) {
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.dynamicClient == nil {
+		return nil, errors.New("the dynamic client is not available, create the client with NewClient or WithDynamicClient")
+	}
+
+	mapping, err := c.restMapping(func() (*meta.RESTMapping, error) {
+		gvk, err := c.restMapper.KindFor(gvr)
+		if err != nil {
+			return nil, err
+		}
+		return c.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error mapping %s: %w", gvr, err)
+	}
+
+	return &DynamicResource{client: c, mapping: mapping}, nil
+
+}
+
+// restMapping runs mapFn, refreshing the discovery information once when the
+// kind is unknown, as it may have been installed after it was read.
+func (c *Client) restMapping(mapFn func() (*meta.RESTMapping, error)) (*meta.RESTMapping, error) {
+
+	mapping, err := mapFn()
+	if !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+
+	resettable, ok := c.restMapper.(meta.ResettableRESTMapper)
+	if !ok {
+		return nil, err
+	}
+
+	resettable.Reset()
+
+	return mapFn()
+
+}
+
+// Namespace returns the resource restricted to namespace. It is ignored for
+// cluster scoped resources. Without it, requests go to the namespace of the
+// object, or the default namespace of the client.
+func (r *DynamicResource) Namespace(namespace string) *DynamicResource {
+	namespaced := *r
+	namespaced.namespace = namespace
+	return &namespaced
+}
+
+// GroupVersionResource returns the resource of the objects.
+func (r *DynamicResource) GroupVersionResource() schema.GroupVersionResource {
+	return r.mapping.Resource
+}
+
+// GroupVersionKind returns the kind of the objects.
+func (r *DynamicResource) GroupVersionKind() schema.GroupVersionKind {
+	return r.mapping.GroupVersionKind
+}
+
+// Namespaced reports whether the objects belong to a namespace.
+func (r *DynamicResource) Namespaced() bool {
+	return r.mapping.Scope.Name() == meta.RESTScopeNameNamespace
+}
+
+// resolveNamespace returns the namespace a request is sent to: namespace,
+// the namespace of the resource, or the default namespace of the client.
+func (r *DynamicResource) resolveNamespace(namespace string) string {
+
+	if !r.Namespaced() {
+		return ""
+	}
+
+	if namespace == "" {
+		namespace = r.namespace
+	}
+
+	return r.client.resolveNamespace(namespace)
+
+}
+
+func (r *DynamicResource) resource(namespace string) dynamic.ResourceInterface {
+
+	resource := r.client.dynamicClient.Resource(r.mapping.Resource)
+
+	if !r.Namespaced() {
+		return resource
+	}
+
+	return resource.Namespace(listNamespace(namespace))
+
+}
+
+// Create creates the object.
+func (r *DynamicResource) Create(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+
+	obj = r.client.withOwner(r.withNamespace(obj))
+
+	var result *unstructured.Unstructured
+
+	err := r.client.do(ctx, OpCreate, r.mapping.GroupVersionKind.Kind, obj.GetNamespace(), obj.GetName(), func(ctx context.Context) error {
+		var err error
+		result, err = r.resource(obj.GetNamespace()).Create(ctx, obj, r.client.createOptions())
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// Get returns the object name.
+func (r *DynamicResource) Get(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+
+	namespace := r.resolveNamespace("")
+
+	var result *unstructured.Unstructured
+
+	err := r.client.do(ctx, OpGet, r.mapping.GroupVersionKind.Kind, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = r.resource(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// Update replaces the object. Its resourceVersion must be the current one.
+func (r *DynamicResource) Update(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+
+	obj = r.client.withOwner(r.withNamespace(obj))
+
+	var result *unstructured.Unstructured
+
+	err := r.client.do(ctx, OpUpdate, r.mapping.GroupVersionKind.Kind, obj.GetNamespace(), obj.GetName(), func(ctx context.Context) error {
+		var err error
+		result, err = r.resource(obj.GetNamespace()).Update(ctx, obj, r.client.updateOptions())
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// List lists the objects matching listOptions.
+func (r *DynamicResource) List(ctx context.Context, listOptions ListOptions) (*unstructured.UnstructuredList, error) {
+
+	namespace := r.resolveNamespace("")
+
+	var result *unstructured.UnstructuredList
+
+	err := r.client.do(ctx, OpList, r.mapping.GroupVersionKind.Kind, namespace, "", func(ctx context.Context) error {
+		var err error
+		result, err = r.resource(namespace).List(ctx, listOptions.metav1())
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// Delete deletes the object name and, in the foreground, its dependents.
+func (r *DynamicResource) Delete(ctx context.Context, name string) error {
+
+	namespace := r.resolveNamespace("")
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return r.client.do(ctx, OpDelete, r.mapping.GroupVersionKind.Kind, namespace, name, func(ctx context.Context) error {
+		return r.resource(namespace).Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            r.client.dryRunOption(),
+		})
+	})
+
+}
+
+// Patch sends a patch of the given type to the object name.
+func (r *DynamicResource) Patch(ctx context.Context, name string, patchType types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+
+	namespace := r.resolveNamespace("")
+
+	var result *unstructured.Unstructured
+
+	err := r.client.do(ctx, OpPatch, r.mapping.GroupVersionKind.Kind, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = r.resource(namespace).Patch(ctx, name, patchType, data, r.client.patchOptions())
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// Apply creates or updates the object using server-side apply, so only the
+// fields set in obj are owned by the field manager. The status and the
+// server-managed metadata of obj are ignored. The object is stamped for
+// DetectDrift.
+func (r *DynamicResource) Apply(ctx context.Context, obj *unstructured.Unstructured, applyOptions ApplyOptions) (*unstructured.Unstructured, error) {
+
+	obj = r.withNamespace(obj)
+	kind := r.mapping.GroupVersionKind.Kind
+
+	applied := obj.DeepCopy()
+	applied.SetGroupVersionKind(r.mapping.GroupVersionKind)
+	applied.SetManagedFields(nil)
+	applied.SetResourceVersion("")
+	unstructured.RemoveNestedField(applied.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(applied.Object, "status")
+
+	labels, annotations, err := r.client.driftStamps(applied)
+	if err != nil {
+		return nil, newError(OpApply, kind, obj.GetNamespace(), obj.GetName(), err)
+	}
+	applied.SetLabels(mergeStrings(applied.GetLabels(), labels))
+	applied.SetAnnotations(mergeStrings(applied.GetAnnotations(), annotations))
+
+	data, err := json.Marshal(applied)
+	if err != nil {
+		return nil, newError(OpApply, kind, obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	var result *unstructured.Unstructured
+
+	err = r.client.do(ctx, OpApply, kind, obj.GetNamespace(), obj.GetName(), func(ctx context.Context) error {
+		var err error
+		result, err = r.resource(obj.GetNamespace()).Patch(ctx, obj.GetName(), types.ApplyPatchType, data, r.client.applyOptions(applyOptions).ToPatchOptions())
+		return applyError(kind, obj.GetNamespace(), obj.GetName(), err)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// Watch calls fn for every change of the objects matching listOptions, as
+// the typed Watch* functions do.
+func (r *DynamicResource) Watch(ctx context.Context, listOptions ListOptions, fn func(UnstructuredEvent) error) error {
+
+	namespace := r.resolveNamespace("")
+
+	return r.client.watch(ctx, r.mapping.GroupVersionKind.Kind, namespace, listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return r.resource(namespace).List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return r.resource(namespace).Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(UnstructuredEvent{Type: eventType, Object: obj.(*unstructured.Unstructured)})
+	})
+
+}
+
+// withNamespace returns obj in the namespace requests are sent to.
+func (r *DynamicResource) withNamespace(obj *unstructured.Unstructured) *unstructured.Unstructured {
+
+	namespace := r.resolveNamespace(obj.GetNamespace())
+	if namespace == obj.GetNamespace() {
+		return obj
+	}
+
+	obj = obj.DeepCopy()
+	obj.SetNamespace(namespace)
+
+	return obj
+
+}
+
+// ObjectGVK returns the kind of a typed or unstructured object: the kind it
+// sets, or the kind the client-go scheme registers for its type.
+func ObjectGVK(obj runtime.Object) (schema.GroupVersionKind, error) {
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Kind != "" && gvk.Version != "" {
+		return gvk, nil
+	}
+
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("unknown kind of %T, set its apiVersion and kind: %w", obj, err)
+	}
+
+	return gvks[0], nil
+
+}
+
+// ToUnstructured converts a typed object into an unstructured one, setting
+// its apiVersion and kind.
+func ToUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error converting %s: %w", gvk.Kind, err)
+	}
+
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+
+	return u, nil
+
+}
+
+// FromUnstructured fills the typed object obj from u.
+func FromUnstructured(u *unstructured.Unstructured, obj runtime.Object) error {
+
+	if target, ok := obj.(*unstructured.Unstructured); ok {
+		u.DeepCopyInto(target)
+		return nil
+	}
+
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj)
+
+}
+
+// objectResource returns the unstructured form of obj and its resource.
+func (c *Client) objectResource(obj runtime.Object) (*unstructured.Unstructured, *DynamicResource, error) {
+
+	u, err := ToUnstructured(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resource, err := c.Resource(u.GroupVersionKind())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, resource, nil
+
+}
+
+// CreateObject creates a typed or unstructured object of any kind, and fills
+// it with the object returned by the API server.
+func (c *Client) CreateObject(ctx context.Context, obj runtime.Object) error {
+
+	u, resource, err := c.objectResource(obj)
+	if err != nil {
+		return err
+	}
+
+	result, err := resource.Create(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	return FromUnstructured(result, obj)
+
+}
+
+// GetObject fills the typed or unstructured object obj, whose kind tells
+// which resource to read, with the object name in namespace.
+func (c *Client) GetObject(ctx context.Context, name, namespace string, obj runtime.Object) error {
+
+	gvk, err := ObjectGVK(obj)
+	if err != nil {
+		return err
+	}
+
+	resource, err := c.Resource(gvk)
+	if err != nil {
+		return err
+	}
+
+	result, err := resource.Namespace(namespace).Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return FromUnstructured(result, obj)
+
+}
+
+// UpdateObject replaces a typed or unstructured object of any kind, and fills
+// it with the object returned by the API server.
+func (c *Client) UpdateObject(ctx context.Context, obj runtime.Object) error {
+
+	u, resource, err := c.objectResource(obj)
+	if err != nil {
+		return err
+	}
+
+	result, err := resource.Update(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	return FromUnstructured(result, obj)
+
+}
+
+// DeleteObject deletes a typed or unstructured object of any kind.
+func (c *Client) DeleteObject(ctx context.Context, obj runtime.Object) error {
+
+	u, resource, err := c.objectResource(obj)
+	if err != nil {
+		return err
+	}
+
+	return resource.Namespace(u.GetNamespace()).Delete(ctx, u.GetName())
+
+}
+
+// ApplyObject creates or updates a typed or unstructured object of any kind
+// using server-side apply, and fills it with the object returned by the API
+// server.
+func (c *Client) ApplyObject(ctx context.Context, obj runtime.Object, applyOptions ApplyOptions) error {
+
+	u, resource, err := c.objectResource(obj)
+	if err != nil {
+		return err
+	}
+
+	result, err := resource.Apply(ctx, u, applyOptions)
+	if err != nil {
+		return err
+	}
+
+	return FromUnstructured(result, obj)
+
+}
+
+// Resource calls Client.Resource on the default client.
+func Resource(gvk schema.GroupVersionKind) (*DynamicResource, error) {
+	return defaultClient().Resource(gvk)
+}
+
+// ResourceForGVR calls Client.ResourceForGVR on the default client.
+func ResourceForGVR(gvr schema.GroupVersionResource) (*DynamicResource, error) {
+	return defaultClient().ResourceForGVR(gvr)
+}
+
+// CreateObject calls Client.CreateObject on the default client.
+func CreateObject(obj runtime.Object) error {
+	return defaultClient().CreateObject(context.Background(), obj)
+}
+
+// GetObject calls Client.GetObject on the default client.
+func GetObject(name, namespace string, obj runtime.Object) error {
+	return defaultClient().GetObject(context.Background(), name, namespace, obj)
+}
+
+// UpdateObject calls Client.UpdateObject on the default client.
+func UpdateObject(obj runtime.Object) error {
+	return defaultClient().UpdateObject(context.Background(), obj)
+}
+
+// DeleteObject calls Client.DeleteObject on the default client.
+func DeleteObject(obj runtime.Object) error {
+	return defaultClient().DeleteObject(context.Background(), obj)
+}
+
+// ApplyObject calls Client.ApplyObject on the default client.
+func ApplyObject(obj runtime.Object, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyObject(context.Background(), obj, applyOptions)
+}
@@ -0,0 +1,199 @@
+package clientk8s
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var widgetKind = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+// discoveringMapper knows widgets only once reset, as a discovery mapper
+// does after their custom resource definition is installed.
+type discoveringMapper struct {
+	meta.RESTMapper
+	resets int
+}
+
+func (m *discoveringMapper) Reset() {
+	m.resets++
+}
+
+func (m *discoveringMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	if m.resets == 0 {
+		return nil, &meta.NoKindMatchError{GroupKind: gk, SearchedVersions: versions}
+	}
+	return m.RESTMapper.RESTMapping(gk, versions...)
+}
+
+func widget(name string, size int64) *unstructured.Unstructured {
+
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(widgetKind)
+	u.SetName(name)
+	unstructured.SetNestedField(u.Object, size, "spec", "size")
+
+	return u
+
+}
+
+func TestDynamicResourceCustomKind(t *testing.T) {
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(widgetKind, meta.RESTScopeNamespace)
+	discovering := &discoveringMapper{RESTMapper: mapper}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Group: "example.com", Version: "v1", Resource: "widgets"}: "WidgetList",
+	})
+	c := NewClientFromClientset(fake.NewSimpleClientset(), WithNamespace("apps"), WithDynamicClient(dynamicClient), WithRESTMapper(discovering))
+	ctx := context.Background()
+
+	widgets, err := c.Resource(widgetKind)
+	if err != nil {
+		t.Fatalf("Resource() error = %v", err)
+	}
+	if discovering.resets != 1 {
+		t.Errorf("mapper reset %d times, want once for the unknown kind", discovering.resets)
+	}
+	if gvr := widgets.GroupVersionResource(); gvr.Resource != "widgets" || !widgets.Namespaced() {
+		t.Errorf("resource = %s, namespaced %v, want namespaced widgets", gvr, widgets.Namespaced())
+	}
+
+	created, err := widgets.Create(ctx, widget("small", 1))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.GetNamespace() != "apps" {
+		t.Errorf("created in %q, want the namespace of the client", created.GetNamespace())
+	}
+
+	unstructured.SetNestedField(created.Object, int64(2), "spec", "size")
+	if _, err := widgets.Update(ctx, created); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got, err := widgets.Get(ctx, "small")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if size, _, _ := unstructured.NestedInt64(got.Object, "spec", "size"); size != 2 {
+		t.Errorf("size = %d, want the updated 2", size)
+	}
+
+	if _, err := widgets.Namespace("other").Create(ctx, widget("large", 10)); err != nil {
+		t.Fatalf("Create() in other error = %v", err)
+	}
+	list, err := widgets.List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].GetName() != "small" {
+		t.Errorf("List() = %d items, want only the widget of the namespace of the client", len(list.Items))
+	}
+	all, err := widgets.Namespace(AllNamespaces).List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatalf("List() in all namespaces error = %v", err)
+	}
+	if len(all.Items) != 2 {
+		t.Errorf("List() in all namespaces = %d items, want 2", len(all.Items))
+	}
+
+	if err := widgets.Delete(ctx, "small"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := widgets.Get(ctx, "small"); !IsNotFound(err) {
+		t.Errorf("Get() after Delete() error = %v, want not found", err)
+	}
+
+}
+
+func TestDynamicResourceClusterScoped(t *testing.T) {
+
+	c := newDynamicTestClient()
+
+	clusterRoles, err := c.ResourceForGVR(schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"})
+	if err != nil {
+		t.Fatalf("ResourceForGVR() error = %v", err)
+	}
+	if clusterRoles.Namespaced() || clusterRoles.GroupVersionKind().Kind != KindClusterRole {
+		t.Fatalf("resource = %s, want the cluster scoped ClusterRole", clusterRoles.GroupVersionKind())
+	}
+
+	u, err := ToUnstructured(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("ToUnstructured() error = %v", err)
+	}
+
+	// The namespaces are ignored.
+	created, err := clusterRoles.Namespace("other").Create(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.GetNamespace() != "" {
+		t.Errorf("cluster role created in %q, want no namespace", created.GetNamespace())
+	}
+	if _, err := clusterRoles.Namespace("other").Get(context.Background(), "reader"); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+
+}
+
+func TestTypedObjects(t *testing.T) {
+
+	c := newDynamicTestClient()
+	ctx := context.Background()
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+		Data:       map[string]string{"a": "1"},
+	}
+	if err := c.CreateObject(ctx, configMap); err != nil {
+		t.Fatalf("CreateObject() error = %v", err)
+	}
+
+	configMap.Data["a"] = "2"
+	if err := c.UpdateObject(ctx, configMap); err != nil {
+		t.Fatalf("UpdateObject() error = %v", err)
+	}
+
+	got := &v1.ConfigMap{}
+	if err := c.GetObject(ctx, "settings", "default", got); err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	if got.Data["a"] != "2" {
+		t.Errorf("data = %v, want the update", got.Data)
+	}
+
+	if err := c.DeleteObject(ctx, got); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	if err := c.GetObject(ctx, "settings", "default", &v1.ConfigMap{}); !IsNotFound(err) {
+		t.Errorf("GetObject() after DeleteObject() error = %v, want not found", err)
+	}
+
+	// Objects of unknown types need their kind.
+	if _, err := ObjectGVK(&unstructured.Unstructured{}); err == nil {
+		t.Error("ObjectGVK() of an object without a kind returned no error")
+	}
+
+}
+
+func TestResourceWithoutDynamicClient(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+
+	if _, err := c.Resource(widgetKind); err == nil {
+		t.Fatal("Resource() without a dynamic client returned no error")
+	}
+
+}
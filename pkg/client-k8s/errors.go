@@ -0,0 +1,164 @@
+package clientk8s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// Operations reported in Error.Op.
+const (
+	OpCreate = "create"
+	OpGet    = "get"
+	OpUpdate = "update"
+	OpList   = "list"
+	OpDelete = "delete"
+	OpApply  = "apply"
+	OpPatch  = "patch"
+	OpWatch  = "watch"
+
+	OpCreateOrUpdate = "createOrUpdate"
+)
+
+// Cause is a field-level cause of a failed request, taken from the details of
+// the metav1.Status returned by the API server.
+type Cause struct {
+	Type    metav1.CauseType
+	Field   string
+	Message string
+}
+
+// Error is returned by every function of the package when a request fails.
+// It records which operation failed on which object, and keeps the
+// underlying client-go error available through errors.Unwrap.
+type Error struct {
+	Op        string
+	Kind      string
+	Namespace string
+	Name      string
+	// Reason and Code come from the metav1.Status returned by the API
+	// server. They are empty when the request did not reach it.
+	Reason metav1.StatusReason
+	Code   int32
+	Causes []Cause
+	Err    error
+}
+
+func (e *Error) Error() string {
+	object := e.Kind
+	if e.Name != "" {
+		name := e.Name
+		if e.Namespace != "" {
+			name = e.Namespace + "/" + e.Name
+		}
+		object = fmt.Sprintf("%s %s", e.Kind, name)
+	} else if e.Namespace != "" {
+		object = fmt.Sprintf("%s in %s", e.Kind, e.Namespace)
+	}
+
+	return fmt.Sprintf("%s %s: %v", e.Op, object, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError wraps err into an Error. A nil err stays nil and errors already
+// wrapped by the package are returned unchanged.
+func newError(op, kind, namespace, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var libErr *Error
+	if errors.As(err, &libErr) {
+		return err
+	}
+
+	result := &Error{
+		Op:        op,
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Err:       err,
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		result.Reason = status.Status().Reason
+		result.Code = status.Status().Code
+		if details := status.Status().Details; details != nil {
+			for _, cause := range details.Causes {
+				result.Causes = append(result.Causes, Cause{
+					Type:    cause.Type,
+					Field:   cause.Field,
+					Message: cause.Message,
+				})
+			}
+		}
+	}
+
+	return result
+}
+
+// IsNotFound reports whether the object does not exist.
+func IsNotFound(err error) bool {
+	return apierrors.IsNotFound(err)
+}
+
+// IsConflict reports whether the request was rejected because of a
+// concurrent modification or a field manager conflict.
+func IsConflict(err error) bool {
+	return apierrors.IsConflict(err)
+}
+
+// IsForbidden reports whether the request was denied by authorization.
+func IsForbidden(err error) bool {
+	return apierrors.IsForbidden(err)
+}
+
+// IsAlreadyExists reports whether the object being created already exists.
+func IsAlreadyExists(err error) bool {
+	return apierrors.IsAlreadyExists(err)
+}
+
+// IsInvalid reports whether the object was rejected by validation. The
+// offending fields are listed in Error.Causes.
+func IsInvalid(err error) bool {
+	return apierrors.IsInvalid(err)
+}
+
+// IsRetryable reports whether the request failed for a transient reason, such
+// as throttling, a timeout, an API server error or a dropped connection, and
+// may succeed if sent again.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return status.Status().Code >= 500
+	}
+
+	// IsProbableEOF doesn't unwrap the errors of the package.
+	return utilnet.IsConnectionReset(err) ||
+		utilnet.IsConnectionRefused(err) ||
+		utilnet.IsProbableEOF(err) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		utilnet.IsTimeout(err)
+}
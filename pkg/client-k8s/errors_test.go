@@ -0,0 +1,112 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var configMaps = schema.GroupResource{Resource: "configmaps"}
+
+func TestErrorFromRequest(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+
+	_, err := c.GetConfigMap(context.Background(), "settings", "default")
+
+	var libErr *Error
+	if !errors.As(err, &libErr) {
+		t.Fatalf("GetConfigMap() error = %T, want *Error", err)
+	}
+	if libErr.Op != OpGet || libErr.Kind != KindConfigMap || libErr.Namespace != "default" || libErr.Name != "settings" {
+		t.Errorf("error = %+v, want get ConfigMap default/settings", libErr)
+	}
+	if libErr.Reason != metav1.StatusReasonNotFound || libErr.Code != 404 {
+		t.Errorf("reason, code = %s, %d, want NotFound, 404", libErr.Reason, libErr.Code)
+	}
+	if !IsNotFound(err) || !apierrors.IsNotFound(errors.Unwrap(err)) {
+		t.Error("the error is not classified as not found")
+	}
+	if want := `get ConfigMap default/settings: configmaps "settings" not found`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+}
+
+func TestErrorCauses(t *testing.T) {
+
+	err := newError(OpCreate, KindConfigMap, "default", "bad name", apierrors.NewInvalid(
+		schema.GroupKind{Kind: KindConfigMap}, "bad name", field.ErrorList{
+			field.Invalid(field.NewPath("metadata", "name"), "bad name", "must be a DNS subdomain"),
+		}))
+
+	var libErr *Error
+	if !errors.As(err, &libErr) {
+		t.Fatalf("newError() = %T, want *Error", err)
+	}
+	if !IsInvalid(err) || len(libErr.Causes) != 1 {
+		t.Fatalf("causes = %+v, want one invalid field", libErr.Causes)
+	}
+	if cause := libErr.Causes[0]; cause.Field != "metadata.name" || cause.Type != metav1.CauseTypeFieldValueInvalid {
+		t.Errorf("cause = %+v, want an invalid metadata.name", cause)
+	}
+
+	// Wrapping twice keeps the first operation.
+	if again := newError(OpCreateOrUpdate, KindConfigMap, "default", "bad name", err); again != err {
+		t.Errorf("newError() of an Error = %v, want it unchanged", again)
+	}
+	if newError(OpGet, KindConfigMap, "", "", nil) != nil {
+		t.Error("newError(nil) is not nil")
+	}
+
+}
+
+func TestErrorClassification(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		err       error
+		check     func(error) bool
+		retryable bool
+	}{
+		{"not found", apierrors.NewNotFound(configMaps, "a"), IsNotFound, false},
+		{"conflict", apierrors.NewConflict(configMaps, "a", errors.New("changed")), IsConflict, false},
+		{"forbidden", apierrors.NewForbidden(configMaps, "a", errors.New("denied")), IsForbidden, false},
+		{"already exists", apierrors.NewAlreadyExists(configMaps, "a"), IsAlreadyExists, false},
+		{"too many requests", apierrors.NewTooManyRequests("slow down", 1), nil, true},
+		{"server timeout", apierrors.NewServerTimeout(configMaps, "get", 1), nil, true},
+		{"timeout", apierrors.NewTimeoutError("timeout", 1), nil, true},
+		{"service unavailable", apierrors.NewServiceUnavailable("down"), nil, true},
+		{"internal error", apierrors.NewInternalError(errors.New("boom")), nil, true},
+		{"bad gateway", apierrors.NewGenericServerResponse(502, "get", configMaps, "a", "", 0, false), nil, true},
+		{"bad request", apierrors.NewBadRequest("bad"), nil, false},
+		{"connection reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, nil, true},
+		{"connection refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, nil, true},
+		{"eof", io.EOF, nil, true},
+		{"other", errors.New("other"), nil, false},
+		{"nil", nil, nil, false},
+	}
+	for _, tt := range tests {
+		wrapped := newError(OpGet, KindConfigMap, "default", "a", tt.err)
+		for _, err := range []error{tt.err, wrapped, fmt.Errorf("context: %w", wrapped)} {
+			if tt.check != nil && !tt.check(err) {
+				t.Errorf("%s: %v is not classified", tt.name, err)
+			}
+			if got := IsRetryable(err); got != tt.retryable {
+				t.Errorf("%s: IsRetryable(%v) = %v, want %v", tt.name, err, got, tt.retryable)
+			}
+		}
+	}
+
+}
@@ -0,0 +1,361 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// OwnerLabel holds the ID of the app or team owning an object, set by
+	// the clients created with WithOwner. It makes up the inventory Prune
+	// garbage collects.
+	OwnerLabel = "by-client-k8s/owner"
+	// PruneAnnotation set to "false" protects an object from Prune.
+	PruneAnnotation = "by-client-k8s/prune"
+)
+
+// PruneStatus is the outcome of pruning one object.
+type PruneStatus string
+
+// Outcomes of Prune.
+const (
+	PrunePruned    PruneStatus = "pruned"
+	PruneProtected PruneStatus = "protected"
+	PruneFailed    PruneStatus = "failed"
+)
+
+// PruneResult is the outcome of pruning one object.
+type PruneResult struct {
+	GroupVersionKind schema.GroupVersionKind
+	Namespace        string
+	Name             string
+	Status           PruneStatus
+	// Err is the reason of a PruneFailed status.
+	Err error
+}
+
+func (r PruneResult) String() string {
+
+	name := r.Name
+	if r.Namespace != "" {
+		name = r.Namespace + "/" + r.Name
+	}
+
+	return fmt.Sprintf("%s %s %s", r.GroupVersionKind.Kind, name, r.Status)
+
+}
+
+// WithOwner labels every object the client creates, updates or applies with
+// OwnerLabel set to owner, adding it to the inventory of owner. Use
+// Client.ForOwner for a single call.
+func WithOwner(owner string) Option {
+	return func(c *Client) {
+		c.owner = owner
+	}
+}
+
+// ForOwner returns a copy of the client labelling the objects it writes with
+// owner, as WithOwner does. The copy shares everything else with c.
+func (c *Client) ForOwner(owner string) *Client {
+	clone := *c
+	clone.owner = owner
+	return &clone
+}
+
+// ownerLabels returns the labels the client sets on the objects it writes.
+func (c *Client) ownerLabels() map[string]string {
+	if c.owner == "" {
+		return nil
+	}
+	return map[string]string{OwnerLabel: c.owner}
+}
+
+// labelOwner sets the owner label of the client on obj.
+func (c *Client) labelOwner(obj metav1.Object) {
+
+	if c.owner == "" {
+		return
+	}
+
+	obj.SetLabels(mergeStrings(obj.GetLabels(), c.ownerLabels()))
+
+}
+
+// withOwner returns obj with the owner label of the client, copying obj when
+// the label is missing.
+func (c *Client) withOwner(obj *unstructured.Unstructured) *unstructured.Unstructured {
+
+	if c.owner == "" || obj.GetLabels()[OwnerLabel] == c.owner {
+		return obj
+	}
+
+	obj = obj.DeepCopy()
+	c.labelOwner(obj)
+
+	return obj
+
+}
+
+// Inventory returns the objects owned by owner in namespace, among the kinds
+// of the package and the given kinds. With AllNamespaces, the cluster scoped
+// objects are returned as well; a single namespace leaves them out, so that a
+// client restricted to its namespace can read its inventory.
+func (c *Client) Inventory(ctx context.Context, owner, namespace string, kinds ...schema.GroupVersionKind) ([]*unstructured.Unstructured, error) {
+
+	if err := validateOwner(owner); err != nil {
+		return nil, err
+	}
+
+	var objects []*unstructured.Unstructured
+
+	err := c.eachInventoryResource(namespace, kinds, func(resource *DynamicResource) error {
+		list, err := resource.List(ctx, ListOptions{LabelSelector: OwnerLabel + "=" + owner})
+		if err != nil {
+			return err
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			// The items of a list may have no kind of their own.
+			obj.SetGroupVersionKind(resource.GroupVersionKind())
+			objects = append(objects, obj)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortManifest(objects)
+
+	return objects, nil
+
+}
+
+// eachInventoryResource calls fn with the resource of the kinds of the
+// package and the given kinds in namespace, skipping the kinds the API server
+// doesn't serve, and the cluster scoped ones unless namespace is
+// AllNamespaces.
+func (c *Client) eachInventoryResource(namespace string, kinds []schema.GroupVersionKind, fn func(resource *DynamicResource) error) error {
+
+	scanned := append([]schema.GroupVersionKind{}, driftKinds...)
+	for _, gvk := range kinds {
+		scanned = appendKind(scanned, gvk)
+	}
+
+	for _, gvk := range scanned {
+		resource, err := c.Resource(gvk)
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !resource.Namespaced() && namespace != AllNamespaces {
+			continue
+		}
+
+		if err := fn(resource.Namespace(namespace)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// Prune deletes the objects in the inventory of owner in namespace that are
+// not desired, such as the ConfigMaps and RBAC of an app left over by a
+// previous release. desired are typed objects, such as the ones returned by
+// the Generate* functions, or unstructured ones; only their kind, namespace
+// and name matter.
+//
+// Objects whose PruneAnnotation is "false" are kept and reported as
+// protected. So is a namespace that still holds objects Prune doesn't delete:
+// protected or desired objects, or objects of the scanned kinds without the
+// owner label of owner. Objects of other kinds are not checked; pass a desired
+// object of each such kind to have it scanned. The objects are deleted in the
+// reverse order of ApplyManifest, so namespaces go last. Every object is
+// pruned even when others fail, and the result of each is returned along with
+// an error listing the failures. On a client in dry-run mode, see
+// Client.DryRun, the deletions are only validated by the API server.
+func (c *Client) Prune(ctx context.Context, owner, namespace string, desired ...runtime.Object) ([]PruneResult, error) {
+
+	desiredKeys := map[string]bool{}
+	var kinds []schema.GroupVersionKind
+
+	for _, obj := range desired {
+		u, resource, err := c.objectResource(obj)
+		if err != nil {
+			return nil, err
+		}
+		key := u.DeepCopy()
+		key.SetNamespace(resource.resolveNamespace(u.GetNamespace()))
+		desiredKeys[driftKey(key)] = true
+		kinds = append(kinds, resource.GroupVersionKind())
+	}
+
+	inventory, err := c.Inventory(ctx, owner, namespace, kinds...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The objects Prune deletes, so that the namespaces still holding others
+	// are kept. They are found before any deletion.
+	pruned := map[string]bool{}
+	for _, obj := range inventory {
+		if !desiredKeys[driftKey(obj)] && !isPruneProtected(obj) {
+			pruned[driftKey(obj)] = true
+		}
+	}
+
+	heldNamespaces := map[string]bool{}
+	for _, obj := range inventory {
+		if !isNamespace(obj) || !pruned[driftKey(obj)] {
+			continue
+		}
+		held, err := c.namespaceHeld(ctx, obj.GetName(), kinds, pruned)
+		if err != nil {
+			return nil, err
+		}
+		heldNamespaces[obj.GetName()] = held
+	}
+
+	var results []PruneResult
+	var errs []error
+
+	for i := len(inventory) - 1; i >= 0; i-- {
+		obj := inventory[i]
+		if desiredKeys[driftKey(obj)] {
+			continue
+		}
+
+		result := c.pruneObject(ctx, obj, isNamespace(obj) && heldNamespaces[obj.GetName()])
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+		results = append(results, result)
+	}
+
+	if len(errs) > 0 {
+		return results, fmt.Errorf("error pruning %d of %d objects: %w", len(errs), len(results), utilerrors.NewAggregate(errs))
+	}
+
+	return results, nil
+
+}
+
+// namespaceHeld reports whether namespace holds objects of the scanned kinds
+// that Prune doesn't delete.
+func (c *Client) namespaceHeld(ctx context.Context, namespace string, kinds []schema.GroupVersionKind, pruned map[string]bool) (bool, error) {
+
+	held := false
+
+	err := c.eachInventoryResource(namespace, kinds, func(resource *DynamicResource) error {
+		if held {
+			return nil
+		}
+
+		list, err := resource.List(ctx, ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			obj.SetGroupVersionKind(resource.GroupVersionKind())
+			if !pruned[driftKey(obj)] {
+				held = true
+				return nil
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return held, nil
+
+}
+
+// pruneObject deletes obj, unless it is protected by its PruneAnnotation or
+// held, as a namespace still holding other objects is.
+func (c *Client) pruneObject(ctx context.Context, obj *unstructured.Unstructured, held bool) PruneResult {
+
+	result := PruneResult{
+		GroupVersionKind: obj.GroupVersionKind(),
+		Namespace:        obj.GetNamespace(),
+		Name:             obj.GetName(),
+		Status:           PruneFailed,
+	}
+
+	if held || isPruneProtected(obj) {
+		result.Status = PruneProtected
+		return result
+	}
+
+	resource, err := c.Resource(obj.GroupVersionKind())
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	err = resource.Namespace(obj.GetNamespace()).Delete(ctx, obj.GetName())
+	if err != nil && !IsNotFound(err) {
+		result.Err = err
+		return result
+	}
+
+	result.Status = PrunePruned
+
+	return result
+
+}
+
+// isPruneProtected reports whether the PruneAnnotation of obj protects it.
+func isPruneProtected(obj *unstructured.Unstructured) bool {
+	return strings.EqualFold(obj.GetAnnotations()[PruneAnnotation], "false")
+}
+
+func isNamespace(obj *unstructured.Unstructured) bool {
+	return obj.GroupVersionKind().GroupKind() == schema.GroupKind{Kind: KindNamespace}
+}
+
+// validateOwner checks that owner can be the value of OwnerLabel.
+func validateOwner(owner string) error {
+
+	if owner == "" {
+		return errors.New("the owner is required")
+	}
+
+	if errs := validation.IsValidLabelValue(owner); len(errs) > 0 {
+		return fmt.Errorf("invalid owner %q: %s", owner, strings.Join(errs, ", "))
+	}
+
+	return nil
+
+}
+
+// Inventory calls Client.Inventory on the default client.
+func Inventory(owner, namespace string, kinds ...schema.GroupVersionKind) ([]*unstructured.Unstructured, error) {
+	return defaultClient().Inventory(context.Background(), owner, namespace, kinds...)
+}
+
+// Prune calls Client.Prune on the default client.
+func Prune(owner, namespace string, desired ...runtime.Object) ([]PruneResult, error) {
+	return defaultClient().Prune(context.Background(), owner, namespace, desired...)
+}
@@ -0,0 +1,154 @@
+package clientk8s
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ownedObject returns obj labelled with owner as unstructured.
+func ownedObject(t *testing.T, obj runtime.Object, owner string, annotations map[string]string) runtime.Object {
+
+	t.Helper()
+
+	u, err := ToUnstructured(obj)
+	if err != nil {
+		t.Fatalf("ToUnstructured() error = %v", err)
+	}
+	u.SetLabels(map[string]string{OwnerLabel: owner})
+	u.SetAnnotations(annotations)
+
+	return u
+
+}
+
+func ownedNamespace(t *testing.T, name, owner string) runtime.Object {
+	return ownedObject(t, &v1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: KindNamespace},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}, owner, nil)
+}
+
+func ownedConfigMap(t *testing.T, namespace, name, owner string, annotations map[string]string) runtime.Object {
+	return ownedObject(t, &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: KindConfigMap},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}, owner, annotations)
+}
+
+var protected = map[string]string{PruneAnnotation: "false"}
+
+func pruneResults(results []PruneResult) []string {
+
+	var got []string
+	for _, result := range results {
+		got = append(got, result.String())
+	}
+	sort.Strings(got)
+
+	return got
+
+}
+
+func TestPruneProtection(t *testing.T) {
+
+	c := newDynamicTestClient(
+		// Only holds objects of the owner: pruned with them.
+		ownedNamespace(t, "old", "app"),
+		ownedConfigMap(t, "old", "a", "app", nil),
+		// Holds a protected object.
+		ownedNamespace(t, "kept", "app"),
+		ownedConfigMap(t, "kept", "b", "app", protected),
+		// Holds an object of another owner.
+		ownedNamespace(t, "shared", "app"),
+		ownedConfigMap(t, "shared", "c", "other", nil),
+		// Holds a desired object.
+		ownedNamespace(t, "current", "app"),
+		ownedConfigMap(t, "current", "d", "app", nil),
+	)
+
+	desired := GenerateConfigMap(Metav1TypeMeta{}, Metav1ObjectMeta{Name: "d", Namespace: "current"}, nil)
+
+	results, err := c.Prune(context.Background(), "app", AllNamespaces, desired)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	want := []string{
+		"ConfigMap kept/b protected",
+		"ConfigMap old/a pruned",
+		"Namespace current protected",
+		"Namespace kept protected",
+		"Namespace old pruned",
+		"Namespace shared protected",
+	}
+	if got := pruneResults(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("Prune() = %v, want %v", got, want)
+	}
+
+	inventory, err := c.Inventory(context.Background(), "app", AllNamespaces)
+	if err != nil {
+		t.Fatalf("Inventory() error = %v", err)
+	}
+	var names []string
+	for _, obj := range inventory {
+		names = append(names, driftKey(obj))
+	}
+	sort.Strings(names)
+
+	wantNames := []string{
+		"ConfigMap/current/d",
+		"ConfigMap/kept/b",
+		"Namespace//current",
+		"Namespace//kept",
+		"Namespace//shared",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("inventory after Prune() = %v, want %v", names, wantNames)
+	}
+
+}
+
+func TestPruneNamespace(t *testing.T) {
+
+	c := newDynamicTestClient(
+		ownedNamespace(t, "team", "app"),
+		ownedConfigMap(t, "team", "a", "app", nil),
+		ownedConfigMap(t, "other", "b", "app", nil),
+	)
+
+	inventory, err := c.Inventory(context.Background(), "app", "team")
+	if err != nil {
+		t.Fatalf("Inventory() error = %v", err)
+	}
+	if len(inventory) != 1 || driftKey(inventory[0]) != "ConfigMap/team/a" {
+		t.Errorf("Inventory() of a namespace = %v, want its config map only", inventory)
+	}
+
+	results, err := c.Prune(context.Background(), "app", "team")
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if want := []string{"ConfigMap team/a pruned"}; !reflect.DeepEqual(pruneResults(results), want) {
+		t.Errorf("Prune() of a namespace = %v, want %v", pruneResults(results), want)
+	}
+
+}
+
+func TestPruneInvalidOwner(t *testing.T) {
+
+	c := newDynamicTestClient()
+
+	if _, err := c.Prune(context.Background(), "", AllNamespaces); err == nil {
+		t.Error("Prune() without an owner returned no error")
+	}
+	if _, err := c.Prune(context.Background(), "not a label value", AllNamespaces); err == nil {
+		t.Error("Prune() with an invalid owner returned no error")
+	}
+
+}
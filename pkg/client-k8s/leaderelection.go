@@ -0,0 +1,218 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionOptions configures RunLeaderElection.
+type LeaderElectionOptions struct {
+	// Name is the name of the Lease the candidates compete for.
+	Name string
+	// Namespace of the Lease. Defaults to the namespace of the client.
+	Namespace string
+	// Identity identifies this candidate in the Lease. Defaults to the host
+	// name followed by a random suffix.
+	Identity string
+	// LeaseDuration is how long the other candidates wait after the last
+	// renewal before taking over. Defaults to 15s.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps trying to renew the Lease
+	// before giving up leadership. Defaults to 10s.
+	RenewDeadline time.Duration
+	// RetryPeriod is the wait between two attempts to acquire or renew the
+	// Lease. Defaults to 2s.
+	RetryPeriod time.Duration
+	// OnStartedLeading is called in its own goroutine once this candidate
+	// becomes the leader. Its context is cancelled when leadership is lost.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called when RunLeaderElection returns, whether this
+	// candidate was the leader or not.
+	OnStoppedLeading func()
+	// OnNewLeader is called with the identity of every new leader, this
+	// candidate included.
+	OnNewLeader func(identity string)
+}
+
+// RunLeaderElection competes for the Lease of opts until ctx is cancelled or
+// leadership is lost, calling the callbacks of opts on the way. The Lease is
+// released when ctx is cancelled, so another candidate takes over without
+// waiting for it to expire.
+func (c *Client) RunLeaderElection(ctx context.Context, opts LeaderElectionOptions) error {
+
+	elector, _, err := c.newLeaderElector(opts)
+	if err != nil {
+		return err
+	}
+
+	elector.Run(ctx)
+
+	return nil
+
+}
+
+func (c *Client) newLeaderElector(opts LeaderElectionOptions) (*leaderelection.LeaderElector, *trackedLock, error) {
+
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	if opts.Name == "" {
+		return nil, nil, errors.New("lease name is required")
+	}
+
+	namespace := c.resolveNamespace(opts.Namespace)
+
+	identity := opts.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting the identity: %w", err)
+		}
+		identity = hostname + "_" + utilrand.String(8)
+	}
+
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = 15 * time.Second
+	}
+	if opts.RenewDeadline <= 0 {
+		opts.RenewDeadline = 10 * time.Second
+	}
+	if opts.RetryPeriod <= 0 {
+		opts.RetryPeriod = 2 * time.Second
+	}
+
+	logger := c.logger.WithValues("lease", namespace+"/"+opts.Name, "identity", identity)
+
+	lock := &trackedLock{
+		Interface: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      opts.Name,
+				Namespace: namespace,
+			},
+			Client: c.clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: identity,
+			},
+		},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   opts.LeaseDuration,
+		RenewDeadline:   opts.RenewDeadline,
+		RetryPeriod:     opts.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            opts.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.Info("Started leading")
+				if opts.OnStartedLeading != nil {
+					opts.OnStartedLeading(ctx)
+				}
+			},
+			OnStoppedLeading: func() {
+				logger.Info("Stopped leading")
+				if opts.OnStoppedLeading != nil {
+					opts.OnStoppedLeading()
+				}
+			},
+			OnNewLeader: func(leader string) {
+				logger.V(1).Info("New leader", "leader", leader)
+				if opts.OnNewLeader != nil {
+					opts.OnNewLeader(leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating the leader election of %s: %w", opts.Name, err)
+	}
+
+	return elector, lock, nil
+
+}
+
+// trackedLock records whether the Lease was ever acquired, which the elector
+// no longer reports once it released it.
+type trackedLock struct {
+	resourcelock.Interface
+	acquired int32
+}
+
+func (l *trackedLock) Create(ctx context.Context, record resourcelock.LeaderElectionRecord) error {
+	err := l.Interface.Create(ctx, record)
+	l.track(record, err)
+	return err
+}
+
+func (l *trackedLock) Update(ctx context.Context, record resourcelock.LeaderElectionRecord) error {
+	err := l.Interface.Update(ctx, record)
+	l.track(record, err)
+	return err
+}
+
+func (l *trackedLock) track(record resourcelock.LeaderElectionRecord, err error) {
+	if err == nil && record.HolderIdentity == l.Identity() {
+		atomic.StoreInt32(&l.acquired, 1)
+	}
+}
+
+func (l *trackedLock) wasAcquired() bool {
+	return atomic.LoadInt32(&l.acquired) == 1
+}
+
+// RunWithLock runs fn while holding the Lease name in the namespace of the
+// client, waiting until no other holder has it. The Lease is released when fn
+// returns. The context of fn is cancelled if the Lease is lost while fn runs.
+func (c *Client) RunWithLock(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var fnErr error
+	done := make(chan struct{})
+
+	elector, lock, err := c.newLeaderElector(LeaderElectionOptions{
+		Name: name,
+		OnStartedLeading: func(ctx context.Context) {
+			defer close(done)
+			defer cancel()
+			fnErr = fn(ctx)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	elector.Run(ctx)
+
+	if !lock.wasAcquired() {
+		return fmt.Errorf("error acquiring lock %s: %w", name, ctx.Err())
+	}
+
+	// fn may still be running when the Lease was lost.
+	<-done
+
+	return fnErr
+
+}
+
+// RunLeaderElection calls Client.RunLeaderElection on the default client.
+func RunLeaderElection(ctx context.Context, opts LeaderElectionOptions) error {
+	return defaultClient().RunLeaderElection(ctx, opts)
+}
+
+// RunWithLock calls Client.RunWithLock on the default client.
+func RunWithLock(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return defaultClient().RunWithLock(ctx, name, fn)
+}
@@ -0,0 +1,141 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func leaseHolder(t *testing.T, clientset *fake.Clientset, name string) string {
+
+	t.Helper()
+
+	lease, err := clientset.CoordinationV1().Leases("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting the lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+
+	return *lease.Spec.HolderIdentity
+
+}
+
+func TestRunWithLock(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset()
+	c := NewClientFromClientset(clientset, WithNamespace("default"))
+
+	fnErr := errors.New("done")
+	called := false
+
+	err := c.RunWithLock(context.Background(), "migrations", func(ctx context.Context) error {
+		called = true
+		if holder := leaseHolder(t, clientset, "migrations"); holder == "" {
+			t.Error("the lease has no holder while fn runs")
+		}
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Fatalf("RunWithLock() error = %v, want the error of fn", err)
+	}
+	if !called {
+		t.Fatal("fn wasn't called")
+	}
+
+	if holder := leaseHolder(t, clientset, "migrations"); holder != "" {
+		t.Errorf("lease held by %q after RunWithLock(), want it released", holder)
+	}
+
+}
+
+func TestRunWithLockHeldByAnother(t *testing.T) {
+
+	holder := "other"
+	duration := int32(60)
+	now := metav1.NewMicroTime(time.Now())
+	clientset := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "migrations", Namespace: "default"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	})
+	c := NewClientFromClientset(clientset, WithNamespace("default"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := c.RunWithLock(ctx, "migrations", func(ctx context.Context) error {
+		t.Error("fn called while another holder has the lease")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunWithLock() error = %v, want the deadline", err)
+	}
+
+	if got := leaseHolder(t, clientset, "migrations"); got != holder {
+		t.Errorf("lease held by %q, want it left to %q", got, holder)
+	}
+
+}
+
+func TestRunLeaderElection(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset(), WithNamespace("default"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// OnNewLeader runs in its own goroutine.
+	leaders := make(chan string, 10)
+	stopped := false
+
+	err := c.RunLeaderElection(ctx, LeaderElectionOptions{
+		Name:     "provisioner",
+		Identity: "replica-1",
+		OnStartedLeading: func(ctx context.Context) {
+			cancel()
+		},
+		OnStoppedLeading: func() {
+			stopped = true
+		},
+		OnNewLeader: func(identity string) {
+			leaders <- identity
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunLeaderElection() error = %v", err)
+	}
+
+	if !stopped {
+		t.Error("OnStoppedLeading wasn't called")
+	}
+	select {
+	case leader := <-leaders:
+		if leader != "replica-1" {
+			t.Errorf("new leader = %q, want replica-1", leader)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("OnNewLeader wasn't called")
+	}
+
+}
+
+func TestRunLeaderElectionRequiresName(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+
+	if err := c.RunLeaderElection(context.Background(), LeaderElectionOptions{}); err == nil {
+		t.Fatal("RunLeaderElection() without a name returned no error")
+	}
+
+}
@@ -0,0 +1,85 @@
+package clientk8s
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
+)
+
+// DefaultPageSize is the number of objects fetched per request by the Each*
+// functions when ListOptions.Limit is not set.
+const DefaultPageSize = 500
+
+// ListOptions filters and paginates the objects returned by the List* and
+// Each* functions.
+type ListOptions struct {
+	// LabelSelector restricts the list to the objects whose labels match,
+	// such as "app=web,tier!=cache".
+	LabelSelector string
+	// FieldSelector restricts the list to the objects whose fields match,
+	// such as "metadata.name=web".
+	FieldSelector string
+	// Limit is the maximum number of objects returned by a List* call, the
+	// next ones being available from Continue. For the Each* functions it is
+	// the page size.
+	Limit int64
+	// Continue is the token returned in the ListMeta of the previous page.
+	Continue string
+	// ResourceVersion and ResourceVersionMatch select how fresh the list
+	// is. An empty ResourceVersion reads the most recent data; "0" lets the
+	// API server answer from its cache.
+	ResourceVersion      string
+	ResourceVersionMatch metav1.ResourceVersionMatch
+}
+
+func (o ListOptions) metav1() metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector:        o.LabelSelector,
+		FieldSelector:        o.FieldSelector,
+		Limit:                o.Limit,
+		Continue:             o.Continue,
+		ResourceVersion:      o.ResourceVersion,
+		ResourceVersionMatch: o.ResourceVersionMatch,
+	}
+}
+
+// each lists the objects of kind page by page, calling fn for every item, so
+// only a page and the next one are held in memory. A page requested after the
+// continue token expired fails with an Expired error.
+func (c *Client) each(ctx context.Context, kind, namespace string, listOptions ListOptions, list func(context.Context, metav1.ListOptions) (runtime.Object, error), fn func(runtime.Object) error) error {
+
+	listPager := c.newPager(kind, namespace, list)
+	listPager.PageBufferSize = 1
+
+	return listPager.EachListItem(ctx, listOptions.metav1(), fn)
+
+}
+
+// newPager returns a pager sending every page as a list request of its own.
+func (c *Client) newPager(kind, namespace string, list func(context.Context, metav1.ListOptions) (runtime.Object, error)) *pager.ListPager {
+
+	listPager := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		// The continue token carries the resourceVersion of the first page;
+		// the API server rejects a page setting both. EachListItem sends
+		// the options of the first page with every token.
+		if opts.Continue != "" {
+			opts.ResourceVersion = ""
+			opts.ResourceVersionMatch = ""
+		}
+
+		var result runtime.Object
+		err := c.do(ctx, OpList, kind, namespace, "", func(ctx context.Context) error {
+			var err error
+			result, err = list(ctx, opts)
+			return err
+		})
+		return result, err
+	})
+
+	listPager.PageSize = DefaultPageSize
+
+	return listPager
+
+}
@@ -0,0 +1,50 @@
+package clientk8s
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEachContinueWithoutResourceVersion(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+
+	pages := map[string]*v1.ConfigMapList{
+		"":  configMapList("10", configMap("a", "1"), configMap("b", "2")),
+		"b": configMapList("10", configMap("c", "3")),
+	}
+	pages[""].Continue = "b"
+
+	// The list requests as the API server validates them.
+	list := func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		if opts.Continue != "" && (opts.ResourceVersion != "" || opts.ResourceVersionMatch != "") {
+			return nil, apierrors.NewGenericServerResponse(http.StatusBadRequest, "list", v1.Resource("configmaps"), "", "specifying resource version is not allowed when using continue", 0, false)
+		}
+		if opts.Continue == "" && opts.ResourceVersion != "0" {
+			t.Errorf("first page resourceVersion = %q, want 0", opts.ResourceVersion)
+		}
+		return pages[opts.Continue], nil
+	}
+
+	var names []string
+	err := c.each(context.Background(), KindConfigMap, "default", ListOptions{Limit: 2, ResourceVersion: "0", ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan}, list, func(obj runtime.Object) error {
+		names = append(names, obj.(*v1.ConfigMap).Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("each() error = %v", err)
+	}
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("items = %v, want %v", names, want)
+	}
+
+}
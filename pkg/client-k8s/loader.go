@@ -0,0 +1,209 @@
+package clientk8s
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ConfigSource tells where the config of a client was loaded from.
+type ConfigSource string
+
+// Sources of the config, in the order they are tried by NewClient.
+const (
+	// ConfigSourceOptions is a config built from WithHost and the
+	// authentication options only.
+	ConfigSourceOptions ConfigSource = "options"
+	// ConfigSourceKubeconfigOption is the kubeconfig given to WithKubeconfig.
+	ConfigSourceKubeconfigOption ConfigSource = "kubeconfig option"
+	// ConfigSourceClientK8sKubeconfig is the kubeconfig at
+	// CLIENT_K8S_KUBECONFIG.
+	ConfigSourceClientK8sKubeconfig ConfigSource = "CLIENT_K8S_KUBECONFIG"
+	// ConfigSourceKubeconfigEnv is the merge of the kubeconfigs listed in
+	// KUBECONFIG.
+	ConfigSourceKubeconfigEnv ConfigSource = "KUBECONFIG"
+	// ConfigSourceHomeKubeconfig is ~/.kube/config.
+	ConfigSourceHomeKubeconfig ConfigSource = "~/.kube/config"
+	// ConfigSourceInCluster is the service account of the pod.
+	ConfigSourceInCluster ConfigSource = "in-cluster"
+)
+
+// AllNamespaces is passed as the namespace of the List*, Each* and Watch*
+// functions to read objects across every namespace. An empty namespace is the
+// default namespace of the client, as for every other namespaced function.
+const AllNamespaces = "*"
+
+// inClusterNamespaceFile holds the namespace of the pod running the client.
+const inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// WithKubeconfig loads the config from the kubeconfig at path, instead of the
+// environment.
+func WithKubeconfig(path string) Option {
+	return func(c *Client) {
+		c.kubeconfig = path
+	}
+}
+
+// WithContext selects the kubeconfig context to use instead of the current
+// one. Defaults to CLIENT_K8S_CONTEXT.
+func WithContext(context string) Option {
+	return func(c *Client) {
+		c.context = context
+	}
+}
+
+// WithNamespace overrides the namespace of the loaded config. Defaults to
+// CLIENT_K8S_NAMESPACE.
+func WithNamespace(namespace string) Option {
+	return func(c *Client) {
+		c.namespace = namespace
+	}
+}
+
+// ConfigSource returns where the config of the client was loaded from. It is
+// empty for clients created by NewClientFromClientset.
+func (c *Client) ConfigSource() ConfigSource {
+	return c.configSource
+}
+
+// Namespace returns the default namespace of the client: the namespace
+// override, the namespace of the kubeconfig context, the namespace of the pod
+// when running in-cluster, or "default".
+func (c *Client) Namespace() string {
+	if c.namespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return c.namespace
+}
+
+// resolveNamespace returns the namespace a request on a namespaced kind is
+// sent to: namespace, or the default namespace of the client when empty.
+func (c *Client) resolveNamespace(namespace string) string {
+	if namespace == "" {
+		return c.Namespace()
+	}
+	return namespace
+}
+
+// listNamespace converts AllNamespaces into the namespace client-go lists
+// every namespace with.
+func listNamespace(namespace string) string {
+	if namespace == AllNamespaces {
+		return metav1.NamespaceAll
+	}
+	return namespace
+}
+
+// loadConfig loads the config from the first available source:
+//
+//   - WithHost, or the kubeconfig given to WithKubeconfig
+//   - the in-cluster config when CLIENT_K8S_RUN_IN_CLUSTER is "cluster"
+//   - the kubeconfig at CLIENT_K8S_KUBECONFIG
+//   - the kubeconfigs listed in KUBECONFIG, merged
+//   - ~/.kube/config
+//   - the in-cluster service account
+//
+// A source that exists but cannot be loaded is an error, rather than falling
+// back to the next one.
+func (c *Client) loadConfig() (*rest.Config, error) {
+
+	if c.context == "" {
+		c.context = os.Getenv("CLIENT_K8S_CONTEXT")
+	}
+	if c.namespace == "" {
+		c.namespace = os.Getenv("CLIENT_K8S_NAMESPACE")
+	}
+
+	if c.auth.host != "" {
+		c.setSource(ConfigSourceOptions, "")
+		return &rest.Config{}, nil
+	}
+
+	if c.kubeconfig != "" {
+		return c.loadKubeconfig(ConfigSourceKubeconfigOption, &clientcmd.ClientConfigLoadingRules{ExplicitPath: c.kubeconfig})
+	}
+
+	if os.Getenv("CLIENT_K8S_RUN_IN_CLUSTER") == "cluster" {
+		return c.loadInCluster()
+	}
+
+	if path := os.Getenv("CLIENT_K8S_KUBECONFIG"); path != "" {
+		return c.loadKubeconfig(ConfigSourceClientK8sKubeconfig, &clientcmd.ClientConfigLoadingRules{ExplicitPath: path})
+	}
+
+	if paths := filepath.SplitList(os.Getenv(clientcmd.RecommendedConfigPathEnvVar)); len(paths) > 0 {
+		config, err := c.loadKubeconfig(ConfigSourceKubeconfigEnv, &clientcmd.ClientConfigLoadingRules{Precedence: paths})
+		if !clientcmd.IsEmptyConfig(err) {
+			return config, err
+		}
+	}
+
+	if _, err := os.Stat(clientcmd.RecommendedHomeFile); err == nil {
+		return c.loadKubeconfig(ConfigSourceHomeKubeconfig, &clientcmd.ClientConfigLoadingRules{ExplicitPath: clientcmd.RecommendedHomeFile})
+	}
+
+	return c.loadInCluster()
+
+}
+
+func (c *Client) loadKubeconfig(source ConfigSource, rules *clientcmd.ClientConfigLoadingRules) (*rest.Config, error) {
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: c.context,
+	})
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		if clientcmd.IsEmptyConfig(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error loading kubeconfig from %s: %w", source, err)
+	}
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig from %s: %w", source, err)
+	}
+
+	c.setSource(source, namespace)
+
+	return config, nil
+
+}
+
+func (c *Client) loadInCluster() (*rest.Config, error) {
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error connection in ClusterConfig: %w", err)
+	}
+
+	namespace := ""
+	if data, err := os.ReadFile(inClusterNamespaceFile); err == nil {
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	c.setSource(ConfigSourceInCluster, namespace)
+
+	return config, nil
+
+}
+
+// setSource records the source of the config and its namespace, unless the
+// namespace is overridden.
+func (c *Client) setSource(source ConfigSource, namespace string) {
+
+	c.configSource = source
+
+	if c.namespace == "" {
+		c.namespace = namespace
+	}
+
+	c.logger.V(1).Info("Loaded config", "source", string(source), "context", c.context, "namespace", c.Namespace())
+
+}
@@ -0,0 +1,224 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ManifestStatus is the outcome of applying one object of a manifest.
+type ManifestStatus string
+
+// Outcomes of ApplyManifest, as reported by kubectl apply.
+const (
+	ManifestCreated    ManifestStatus = "created"
+	ManifestConfigured ManifestStatus = "configured"
+	ManifestUnchanged  ManifestStatus = "unchanged"
+	ManifestFailed     ManifestStatus = "failed"
+)
+
+// ManifestResult is the outcome of applying one object of a manifest.
+type ManifestResult struct {
+	GroupVersionKind schema.GroupVersionKind
+	Namespace        string
+	Name             string
+	Status           ManifestStatus
+	// Object is the object returned by the API server, or the object of the
+	// manifest when the apply failed.
+	Object *unstructured.Unstructured
+	// Err is the reason of a ManifestFailed status.
+	Err error
+}
+
+func (r ManifestResult) String() string {
+
+	name := r.Name
+	if r.Namespace != "" {
+		name = r.Namespace + "/" + r.Name
+	}
+
+	return fmt.Sprintf("%s %s %s", r.GroupVersionKind.Kind, name, r.Status)
+
+}
+
+// manifestKindOrder is the order in which the kinds of a manifest are applied,
+// so that objects are created after the objects they depend on. Other kinds,
+// such as workloads and custom resources, come last in the manifest order.
+var manifestKindOrder = []schema.GroupKind{
+	{Kind: "Namespace"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"},
+	{Group: "storage.k8s.io", Kind: "StorageClass"},
+	{Kind: "ResourceQuota"},
+	{Kind: "LimitRange"},
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"},
+	{Kind: "ServiceAccount"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"},
+	{Kind: "Secret"},
+	{Kind: "ConfigMap"},
+	{Kind: "PersistentVolume"},
+	{Kind: "PersistentVolumeClaim"},
+	{Kind: "Service"},
+}
+
+// ApplyManifest applies the objects of a multi-document YAML or JSON manifest
+// using server-side apply, as kubectl apply --server-side does. Namespaces,
+// CRDs, ServiceAccounts and RBAC are applied before the other kinds, and v1
+// List documents are expanded.
+//
+// Every object is applied even when others fail. The result of each object is
+// returned along with an error listing the failures. A manifest that can't be
+// parsed is rejected before anything is applied.
+func (c *Client) ApplyManifest(ctx context.Context, reader io.Reader, applyOptions ApplyOptions) ([]ManifestResult, error) {
+
+	objects, err := DecodeManifest(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	sortManifest(objects)
+
+	results := make([]ManifestResult, 0, len(objects))
+	var errs []error
+
+	for _, obj := range objects {
+		result := c.applyManifestObject(ctx, obj, applyOptions)
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+		results = append(results, result)
+	}
+
+	if len(errs) > 0 {
+		return results, fmt.Errorf("error applying %d of %d objects: %w", len(errs), len(objects), utilerrors.NewAggregate(errs))
+	}
+
+	return results, nil
+
+}
+
+func (c *Client) applyManifestObject(ctx context.Context, obj *unstructured.Unstructured, applyOptions ApplyOptions) ManifestResult {
+
+	result := ManifestResult{
+		GroupVersionKind: obj.GroupVersionKind(),
+		Namespace:        obj.GetNamespace(),
+		Name:             obj.GetName(),
+		Status:           ManifestFailed,
+		Object:           obj,
+	}
+
+	// The kind is resolved only now, so that the custom resources of a CRD
+	// applied earlier are found.
+	resource, err := c.Resource(obj.GroupVersionKind())
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Namespace = resource.resolveNamespace(obj.GetNamespace())
+
+	current, err := resource.Namespace(result.Namespace).Get(ctx, obj.GetName())
+	if err != nil && !IsNotFound(err) {
+		result.Err = err
+		return result
+	}
+
+	applied, err := resource.Apply(ctx, obj, applyOptions)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Object = applied
+
+	switch {
+	case current == nil:
+		result.Status = ManifestCreated
+	case current.GetResourceVersion() == applied.GetResourceVersion():
+		result.Status = ManifestUnchanged
+	default:
+		result.Status = ManifestConfigured
+	}
+
+	return result
+
+}
+
+// DecodeManifest returns the objects of a multi-document YAML or JSON
+// manifest, in order. Empty documents are skipped and v1 List documents are
+// expanded into their items.
+func DecodeManifest(reader io.Reader) ([]*unstructured.Unstructured, error) {
+
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 4096)
+
+	var objects []*unstructured.Unstructured
+
+	for document := 1; ; document++ {
+		var content map[string]interface{}
+		if err := decoder.Decode(&content); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("error decoding manifest document %d: %w", document, err)
+		}
+
+		if len(content) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{Object: content}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" {
+			return nil, fmt.Errorf("error decoding manifest document %d: apiVersion and kind are required", document)
+		}
+
+		if !obj.IsList() {
+			objects = append(objects, obj)
+			continue
+		}
+
+		err := obj.EachListItem(func(item runtime.Object) error {
+			objects = append(objects, item.(*unstructured.Unstructured))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error decoding manifest document %d: %w", document, err)
+		}
+	}
+
+}
+
+// sortManifest orders objects by manifestKindOrder, keeping the manifest
+// order within a kind.
+func sortManifest(objects []*unstructured.Unstructured) {
+
+	rank := func(obj *unstructured.Unstructured) int {
+		groupKind := obj.GroupVersionKind().GroupKind()
+		for i, kind := range manifestKindOrder {
+			if kind == groupKind {
+				return i
+			}
+		}
+		return len(manifestKindOrder)
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return rank(objects[i]) < rank(objects[j])
+	})
+
+}
+
+// ApplyManifest calls Client.ApplyManifest on the default client.
+func ApplyManifest(reader io.Reader, applyOptions ApplyOptions) ([]ManifestResult, error) {
+	return defaultClient().ApplyManifest(context.Background(), reader, applyOptions)
+}
@@ -0,0 +1,173 @@
+package clientk8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func manifestNames(objects []*unstructured.Unstructured) []string {
+
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, obj.GetKind()+"/"+obj.GetName())
+	}
+
+	return names
+
+}
+
+func TestDecodeManifest(t *testing.T) {
+
+	manifest := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+# Only a comment.
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: b
+---
+{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "apps"}}
+`
+
+	objects, err := DecodeManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("DecodeManifest() error = %v", err)
+	}
+
+	want := "Deployment/web ConfigMap/a Secret/b Namespace/apps"
+	if got := strings.Join(manifestNames(objects), " "); got != want {
+		t.Errorf("DecodeManifest() = %s, want %s", got, want)
+	}
+
+}
+
+func TestDecodeManifestErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"no kind", "apiVersion: v1\nmetadata:\n  name: a\n", "document 1: apiVersion and kind are required"},
+		{"invalid", "apiVersion: v1\nkind: ConfigMap\n---\nkind: [\n", "document 2"},
+	}
+	for _, tt := range tests {
+		_, err := DecodeManifest(strings.NewReader(tt.manifest))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: DecodeManifest() error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+}
+
+func TestSortManifest(t *testing.T) {
+
+	objects, err := DecodeManifest(strings.NewReader(`
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: w}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata: {name: rb}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: b}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata: {name: sa}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata: {name: widgets.example.com}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata: {name: r}
+---
+apiVersion: v1
+kind: Namespace
+metadata: {name: apps}
+`))
+	if err != nil {
+		t.Fatalf("DecodeManifest() error = %v", err)
+	}
+
+	sortManifest(objects)
+
+	want := "Namespace/apps CustomResourceDefinition/widgets.example.com ServiceAccount/sa Role/r RoleBinding/rb ConfigMap/b ConfigMap/a Deployment/web Widget/w"
+	if got := strings.Join(manifestNames(objects), " "); got != want {
+		t.Errorf("sorted manifest = %s, want %s", got, want)
+	}
+
+}
+
+func TestApplyManifestRejectsInvalid(t *testing.T) {
+
+	c := newDynamicTestClient()
+
+	results, err := c.ApplyManifest(context.Background(), strings.NewReader("apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\n---\nmetadata: {name: b}\n"), ApplyOptions{})
+	if err == nil || results != nil {
+		t.Fatalf("ApplyManifest() = %v, %v, want an error without results", results, err)
+	}
+	if actions := c.dynamicClient.(*dynamicfake.FakeDynamicClient).Actions(); len(actions) != 0 {
+		t.Errorf("requests = %v, want none for an invalid manifest", actions)
+	}
+
+}
+
+func TestApplyManifestReportsEveryObject(t *testing.T) {
+
+	c := newDynamicTestClient()
+
+	// The kind isn't served: the other objects are still applied.
+	results, err := c.ApplyManifest(context.Background(), strings.NewReader(`
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: w}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+`), ApplyOptions{})
+	if err == nil {
+		t.Fatal("ApplyManifest() returned no error for the widget")
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %v, want one per object", results)
+	}
+
+	if results[0].Name != "a" || results[0].Namespace != "default" {
+		t.Errorf("first result = %s, want the config map in the default namespace", results[0])
+	}
+	if results[1].Name != "w" || results[1].Status != ManifestFailed || results[1].Err == nil {
+		t.Errorf("last result = %s (%v), want the widget failed", results[1], results[1].Err)
+	}
+
+}
@@ -0,0 +1,190 @@
+package clientk8s
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const metricsNamespace = "clientk8s"
+
+// Values of the result label.
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+// metrics holds the collectors of a client. A nil *metrics records nothing.
+type metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	retries  *prometheus.CounterVec
+	circuit  prometheus.Gauge
+
+	reconciles        *prometheus.CounterVec
+	reconcileDuration *prometheus.HistogramVec
+	queueDepth        *prometheus.GaugeVec
+}
+
+// WithMetrics records a counter and a latency histogram of every operation,
+// labelled by verb, kind, namespace and result, and the number of retries
+// after a conflict or a transient error, the state of the circuit breaker, and
+// the reconciles of the controllers. The collectors are registered in
+// registerer; collectors already registered by another client are shared.
+// A collector that can't be registered, as another one of the same name but
+// different labels is, is logged as an error and left unexported.
+func WithMetrics(registerer prometheus.Registerer) Option {
+	return func(c *Client) {
+		c.metrics, c.metricsErr = newMetrics(registerer)
+	}
+}
+
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+
+	m := &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Number of operations sent to the API server.",
+		}, []string{"verb", "kind", "namespace", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the operations sent to the API server.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"verb", "kind", "namespace", "result"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "retries_total",
+			Help:      "Number of operations retried after a conflict or a transient error.",
+		}, []string{"verb", "kind", "namespace"}),
+		circuit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker: 0 closed, 1 open, 2 half-open.",
+		}),
+		reconciles: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconcile_total",
+			Help:      "Number of reconciles run by the controllers.",
+		}, []string{"controller", "result"}),
+		reconcileDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconcile_duration_seconds",
+			Help:      "Latency of the reconciles run by the controllers.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"controller"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "workqueue_depth",
+			Help:      "Number of keys waiting to be reconciled.",
+		}, []string{"controller"}),
+	}
+
+	var errs []error
+	register := func(collector prometheus.Collector) prometheus.Collector {
+		registered, err := registerCollector(registerer, collector)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return registered
+	}
+
+	m.requests = register(m.requests).(*prometheus.CounterVec)
+	m.duration = register(m.duration).(*prometheus.HistogramVec)
+	m.retries = register(m.retries).(*prometheus.CounterVec)
+	m.circuit = register(m.circuit).(prometheus.Gauge)
+	m.reconciles = register(m.reconciles).(*prometheus.CounterVec)
+	m.reconcileDuration = register(m.reconcileDuration).(*prometheus.HistogramVec)
+	m.queueDepth = register(m.queueDepth).(*prometheus.GaugeVec)
+
+	return m, utilerrors.NewAggregate(errs)
+
+}
+
+// registerCollector registers collector, or returns the equal collector
+// already registered. On any other error, collector is returned unregistered.
+func registerCollector(registerer prometheus.Registerer, collector prometheus.Collector) (prometheus.Collector, error) {
+
+	err := registerer.Register(collector)
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return alreadyRegistered.ExistingCollector, nil
+	}
+	if err != nil {
+		return collector, err
+	}
+
+	return collector, nil
+
+}
+
+// observe records the outcome of an operation.
+func (m *metrics) observe(op, kind, namespace string, err error, duration time.Duration) {
+
+	if m == nil {
+		return
+	}
+
+	result := resultLabel(err)
+
+	m.requests.WithLabelValues(op, kind, namespace, result).Inc()
+	m.duration.WithLabelValues(op, kind, namespace, result).Observe(duration.Seconds())
+
+}
+
+// retry records a retry of an operation.
+func (m *metrics) retry(op, kind, namespace string) {
+
+	if m == nil {
+		return
+	}
+
+	m.retries.WithLabelValues(op, kind, namespace).Inc()
+
+}
+
+// circuitState records the state of the circuit breaker.
+func (m *metrics) circuitState(state CircuitState) {
+
+	if m == nil {
+		return
+	}
+
+	m.circuit.Set(float64(state))
+
+}
+
+// reconcile records the outcome of a reconcile and the keys left in the
+// queue.
+func (m *metrics) reconcile(controller, result string, duration time.Duration, depth int) {
+
+	if m == nil {
+		return
+	}
+
+	m.reconciles.WithLabelValues(controller, result).Inc()
+	m.reconcileDuration.WithLabelValues(controller).Observe(duration.Seconds())
+	m.queueDepth.WithLabelValues(controller).Set(float64(depth))
+
+}
+
+// resultLabel is "success", the status reason returned by the API server, or
+// "error" for failures without one.
+func resultLabel(err error) string {
+
+	if err == nil {
+		return resultSuccess
+	}
+
+	var libErr *Error
+	if errors.As(err, &libErr) && libErr.Reason != "" {
+		return string(libErr.Reason)
+	}
+
+	return resultError
+
+}
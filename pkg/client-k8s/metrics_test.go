@@ -0,0 +1,157 @@
+package clientk8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMetricsRequests(t *testing.T) {
+
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	c := NewClientFromClientset(fake.NewSimpleClientset(), WithMetrics(registry))
+
+	if err := c.CreateConfigMap(ctx, Metav1TypeMeta{}, Metav1ObjectMeta{Name: "settings", Namespace: "default"}, nil); err != nil {
+		t.Fatalf("CreateConfigMap() error = %v", err)
+	}
+	if _, err := c.GetConfigMap(ctx, "settings", "default"); err != nil {
+		t.Fatalf("GetConfigMap() error = %v", err)
+	}
+	if _, err := c.GetConfigMap(ctx, "missing", "default"); !IsNotFound(err) {
+		t.Fatalf("GetConfigMap() error = %v, want not found", err)
+	}
+
+	m := c.metrics
+	tests := []struct {
+		verb, result string
+		want         float64
+	}{
+		{OpCreate, resultSuccess, 1},
+		{OpGet, resultSuccess, 1},
+		{OpGet, string(metav1.StatusReasonNotFound), 1},
+		{OpUpdate, resultSuccess, 0},
+	}
+	for _, tt := range tests {
+		got := testutil.ToFloat64(m.requests.WithLabelValues(tt.verb, KindConfigMap, "default", tt.result))
+		if got != tt.want {
+			t.Errorf("requests_total{verb=%q,result=%q} = %v, want %v", tt.verb, tt.result, got, tt.want)
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	var histograms uint64
+	for _, family := range families {
+		if family.GetName() != "clientk8s_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["kind"] != KindConfigMap || labels["namespace"] != "default" {
+				t.Errorf("unexpected duration labels %v", labels)
+			}
+			histograms += metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if histograms != 3 {
+		t.Errorf("request_duration_seconds samples = %d, want 3", histograms)
+	}
+
+}
+
+func TestMetricsRetriesOnConflict(t *testing.T) {
+
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default"},
+	})
+	c := NewClientFromClientset(clientset, WithMetrics(prometheus.NewRegistry()))
+
+	conflicts := 0
+	clientset.PrependReactor("patch", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 2 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "rbac.authorization.k8s.io", Resource: "roles"}, "reader", nil)
+	})
+
+	if err := c.AddRoleRules(ctx, "reader", "default", []Rbacv1PolicyRule{readRule}); err != nil {
+		t.Fatalf("AddRoleRules() error = %v", err)
+	}
+
+	if got := testutil.ToFloat64(c.metrics.retries.WithLabelValues(OpPatch, KindRole, "default")); got != 2 {
+		t.Errorf("retries_total = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.requests.WithLabelValues(OpPatch, KindRole, "default", string(metav1.StatusReasonConflict))); got != 2 {
+		t.Errorf("requests_total{result=Conflict} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(c.metrics.requests.WithLabelValues(OpPatch, KindRole, "default", resultSuccess)); got != 1 {
+		t.Errorf("requests_total{result=success} = %v, want 1", got)
+	}
+
+}
+
+func TestMetricsSharedRegistry(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	first := NewClientFromClientset(fake.NewSimpleClientset(), WithMetrics(registry))
+	second := NewClientFromClientset(fake.NewSimpleClientset(), WithMetrics(registry))
+
+	if first.metrics.requests != second.metrics.requests {
+		t.Fatal("clients sharing a registry don't share their collectors")
+	}
+
+}
+
+func TestMetricsRegistrationErrorLogged(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Number of operations sent to the API server.",
+	}, []string{"verb"}))
+
+	var logged []string
+	logger := funcr.New(func(prefix, args string) {
+		logged = append(logged, args)
+	}, funcr.Options{})
+
+	c := NewClientFromClientset(fake.NewSimpleClientset(), WithMetrics(registry), WithLogger(logger))
+
+	if len(logged) != 1 || !strings.Contains(logged[0], "Registering the metrics failed") {
+		t.Fatalf("logged %v, want the registration error", logged)
+	}
+
+	// The other collectors are still registered.
+	if err := c.CreateConfigMap(context.Background(), Metav1TypeMeta{}, Metav1ObjectMeta{Name: "settings", Namespace: "default"}, nil); err != nil {
+		t.Fatalf("CreateConfigMap() error = %v", err)
+	}
+	got, err := testutil.GatherAndCount(registry, "clientk8s_request_duration_seconds")
+	if err != nil {
+		t.Fatalf("GatherAndCount() error = %v", err)
+	}
+	if got != 1 {
+		t.Errorf("request_duration_seconds series = %d, want 1", got)
+	}
+
+}
@@ -2,21 +2,20 @@ package clientk8s
 
 import (
 	"context"
-	"log"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 )
 
-func CreateNamespace(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta) error {
-
-	context := context.Background()
+// GenerateNamespace returns the namespace CreateNamespace creates, without
+// sending it to the API server.
+func GenerateNamespace(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta) *v1.Namespace {
 
-	nsSpec := &v1.Namespace{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return &v1.Namespace{
+		TypeMeta: typeMeta.withDefaults(KindNamespace, "v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -25,25 +24,31 @@ func CreateNamespace(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta) error
 		},
 	}
 
-	_, err = k8sClientSet.CoreV1().Namespaces().Create(context, nsSpec, metav1.CreateOptions{})
+}
 
-	if err != nil {
-		log.Printf("Error creating namespace: %v \n", err)
-		return err
-	}
+func (c *Client) CreateNamespace(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta) error {
 
-	return nil
+	nsSpec := GenerateNamespace(typeMeta, objectMeta)
+	c.labelOwner(nsSpec)
+
+	return c.do(ctx, OpCreate, KindNamespace, "", objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().Namespaces().Create(ctx, nsSpec, c.createOptions())
+		return err
+	})
 
 }
 
-func GetNamespace(name string) (*v1.Namespace, error) {
+func (c *Client) GetNamespace(ctx context.Context, name string) (*v1.Namespace, error) {
 
-	context := context.Background()
+	var result *v1.Namespace
 
-	result, err := k8sClientSet.CoreV1().Namespaces().Get(context, name, metav1.GetOptions{})
+	err := c.do(ctx, OpGet, KindNamespace, "", name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting Namespace: %v \n", err)
 		return nil, err
 	}
 
@@ -51,14 +56,17 @@ func GetNamespace(name string) (*v1.Namespace, error) {
 
 }
 
-func ListNamespace() (*v1.NamespaceList, error) {
+func (c *Client) ListNamespace(ctx context.Context, listOptions ListOptions) (*v1.NamespaceList, error) {
 
-	context := context.Background()
+	var result *v1.NamespaceList
 
-	result, err := k8sClientSet.CoreV1().Namespaces().List(context, metav1.ListOptions{})
+	err := c.do(ctx, OpList, KindNamespace, "", "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().Namespaces().List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list Namespaces: %v \n", err)
 		return nil, err
 	}
 
@@ -66,21 +74,105 @@ func ListNamespace() (*v1.NamespaceList, error) {
 
 }
 
-func DeleteNamespace(name string) error {
+// EachNamespace calls fn for every namespace matching listOptions, fetching
+// them page by page. It stops at the first error returned by fn.
+func (c *Client) EachNamespace(ctx context.Context, listOptions ListOptions, fn func(*v1.Namespace) error) error {
+	return c.each(ctx, KindNamespace, "", listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.CoreV1().Namespaces().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*v1.Namespace))
+	})
+}
+
+// NamespaceEvent is a change of a namespace reported by WatchNamespace.
+type NamespaceEvent struct {
+	Type      EventType
+	Namespace *v1.Namespace
+}
+
+// WatchNamespace calls fn for every change of the namespaces matching
+// listOptions, until ctx is cancelled or fn returns an error. It starts with
+// an Added event per existing namespace, unless listOptions.ResourceVersion is
+// set, and resumes from the last resourceVersion when the connection drops.
+func (c *Client) WatchNamespace(ctx context.Context, listOptions ListOptions, fn func(NamespaceEvent) error) error {
+	return c.watch(ctx, KindNamespace, "", listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.CoreV1().Namespaces().List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.CoreV1().Namespaces().Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(NamespaceEvent{Type: eventType, Namespace: obj.(*v1.Namespace)})
+	})
+}
 
-	context := context.Background()
+func (c *Client) DeleteNamespace(ctx context.Context, name string) error {
 
 	deletePolicy := metav1.DeletePropagationForeground
 
-	err := k8sClientSet.CoreV1().Namespaces().Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+	return c.do(ctx, OpDelete, KindNamespace, "", name, func(ctx context.Context) error {
+		return c.clientset.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
 	})
 
+}
+
+// ApplyNamespace creates or updates the namespace using server-side apply, so
+// only the labels and annotations given here are owned by the field manager.
+func (c *Client) ApplyNamespace(ctx context.Context, objectMeta Metav1ObjectMeta, applyOptions ApplyOptions) error {
+
+	nsApply := corev1ac.Namespace(objectMeta.Name).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations)
+
+	labels, annotations, err := c.driftStamps(nsApply)
 	if err != nil {
-		log.Printf("Error delete Namespace: %v \n", err)
-		return err
+		return newError(OpApply, KindNamespace, "", objectMeta.Name, err)
 	}
+	nsApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindNamespace, "", objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().Namespaces().Apply(ctx, nsApply, c.applyOptions(applyOptions))
+		return applyError(KindNamespace, "", objectMeta.Name, err)
+	})
+
+}
+
+// CreateNamespace calls Client.CreateNamespace on the default client.
+func CreateNamespace(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta) error {
+	return defaultClient().CreateNamespace(context.Background(), typeMeta, objectMeta)
+}
 
-	return nil
+// GetNamespace calls Client.GetNamespace on the default client.
+func GetNamespace(name string) (*v1.Namespace, error) {
+	return defaultClient().GetNamespace(context.Background(), name)
+}
+
+// ListNamespace calls Client.ListNamespace on the default client, without list
+// options.
+func ListNamespace() (*v1.NamespaceList, error) {
+	return defaultClient().ListNamespace(context.Background(), ListOptions{})
+}
+
+// EachNamespace calls Client.EachNamespace on the default client.
+func EachNamespace(listOptions ListOptions, fn func(*v1.Namespace) error) error {
+	return defaultClient().EachNamespace(context.Background(), listOptions, fn)
+}
+
+// WatchNamespace calls Client.WatchNamespace on the default client.
+func WatchNamespace(listOptions ListOptions, fn func(NamespaceEvent) error) error {
+	return defaultClient().WatchNamespace(context.Background(), listOptions, fn)
+}
+
+// DeleteNamespace calls Client.DeleteNamespace on the default client.
+func DeleteNamespace(name string) error {
+	return defaultClient().DeleteNamespace(context.Background(), name)
+}
 
+// ApplyNamespace calls Client.ApplyNamespace on the default client.
+func ApplyNamespace(objectMeta Metav1ObjectMeta, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyNamespace(context.Background(), objectMeta, applyOptions)
 }
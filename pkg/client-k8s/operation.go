@@ -0,0 +1,155 @@
+package clientk8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// do runs a single request against the API server within its own span,
+// sending it again on transient errors as allowed by the retry policy, and
+// failing it without sending it while the circuit breaker is open. It
+// wraps the returned error into an Error, and logs and records the outcome
+// with the request attributes.
+func (c *Client) do(ctx context.Context, op, kind, namespace, name string, fn func(context.Context) error) error {
+
+	if c.err != nil {
+		return newError(op, kind, namespace, name, c.err)
+	}
+
+	if namespace == AllNamespaces && op != OpList && op != OpWatch {
+		return newError(op, kind, namespace, name, fmt.Errorf("namespace %q is only supported by list and watch", AllNamespaces))
+	}
+
+	start := time.Now()
+
+	ctx, span := c.startSpan(ctx, op, kind, namespace, name)
+
+	// Requests are not retried once the breaker opened.
+	policy := c.retryPolicy
+	retryable := policy.retryable
+	policy.Retryable = func(err error) bool {
+		return c.breaker.state() != CircuitOpen && retryable(err)
+	}
+
+	var lastErr error
+	err := policy.withRetries(ctx, func() error {
+		if err := c.breaker.allow(); err != nil {
+			// A retry stopped by the breaker reports the failure that
+			// opened it.
+			if lastErr != nil {
+				return lastErr
+			}
+			return newError(op, kind, namespace, name, err)
+		}
+		err := fn(ctx)
+		c.breaker.done(err)
+		lastErr = newError(op, kind, namespace, name, err)
+		return lastErr
+	}, func(attempt int, err error) {
+		c.metrics.retry(op, kind, namespace)
+		c.logger.V(1).Info("Retrying after transient error", "verb", op, "kind", kind, "namespace", namespace, "name", name, "attempt", attempt, "error", err.Error())
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt)))
+	})
+
+	duration := time.Since(start)
+	c.metrics.observe(op, kind, namespace, err, duration)
+	endSpan(span, err)
+
+	keysAndValues := []interface{}{
+		"verb", op,
+		"kind", kind,
+		"namespace", namespace,
+		"name", name,
+		"duration", duration,
+	}
+
+	switch {
+	case err == nil:
+		c.logger.V(1).Info("Request succeeded", keysAndValues...)
+	case IsNotFound(err):
+		c.logger.V(1).Info("Object not found", keysAndValues...)
+	default:
+		c.logger.Error(err, "Request failed", keysAndValues...)
+	}
+
+	return err
+
+}
+
+// retryOnConflict runs fn, usually a read-modify-write sequence, again while
+// it fails because of a concurrent writer. Every new attempt is recorded as a
+// retry of op, and as an event of the current span.
+func (c *Client) retryOnConflict(ctx context.Context, op, kind, namespace, name string, fn func(context.Context) error) error {
+
+	attempt := 0
+
+	return retry.OnError(c.retryPolicy.conflictBackoff(), isCreateOrUpdateConflict, func() error {
+		if attempt > 0 {
+			c.metrics.retry(op, kind, namespace)
+			c.logger.V(1).Info("Retrying after conflict", "verb", op, "kind", kind, "namespace", namespace, "name", name, "attempt", attempt)
+			trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		}
+		attempt++
+		return fn(ctx)
+	})
+
+}
+
+// metadataUpToDate reports whether obj has the labels and annotations of
+// objectMeta, and the owner label of the client. Other labels and annotations
+// are ignored.
+func (c *Client) metadataUpToDate(obj metav1.Object, objectMeta Metav1ObjectMeta) bool {
+	return containsStrings(obj.GetLabels(), mergeStrings(objectMeta.Labels, c.ownerLabels())) &&
+		containsStrings(obj.GetAnnotations(), objectMeta.Annotations)
+}
+
+// setMetadata adds the labels and annotations of objectMeta to obj, keeping
+// the others. The Update* functions add the owner label.
+func setMetadata(obj metav1.Object, objectMeta Metav1ObjectMeta) {
+
+	if len(objectMeta.Labels) > 0 {
+		obj.SetLabels(mergeStrings(obj.GetLabels(), objectMeta.Labels))
+	}
+
+	if len(objectMeta.Annotations) > 0 {
+		obj.SetAnnotations(mergeStrings(obj.GetAnnotations(), objectMeta.Annotations))
+	}
+
+}
+
+// containsStrings reports whether every key of b has the same value in a.
+func containsStrings(a, b map[string]string) bool {
+
+	for key, value := range b {
+		if current, ok := a[key]; !ok || current != value {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// createOrUpdate runs the get and create or update sequence of a
+// CreateOrUpdate* function, retrying it on conflicts, and records it as a
+// single operation whose span is the parent of the individual requests.
+func (c *Client) createOrUpdate(ctx context.Context, kind, namespace, name string, fn func(context.Context) error) error {
+
+	start := time.Now()
+
+	ctx, span := c.startSpan(ctx, OpCreateOrUpdate, kind, namespace, name)
+
+	err := c.retryOnConflict(ctx, OpCreateOrUpdate, kind, namespace, name, fn)
+
+	c.metrics.observe(OpCreateOrUpdate, kind, namespace, err, time.Since(start))
+	endSpan(span, err)
+
+	return err
+
+}
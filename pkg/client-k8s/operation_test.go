@@ -0,0 +1,97 @@
+package clientk8s
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateMetadata(t *testing.T) {
+
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "settings",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "web", OwnerLabel: "old-release", "extra": "kept"},
+		},
+		Data: map[string]string{"a": "1"},
+	})
+	c := NewClientFromClientset(clientset, WithOwner("release"))
+
+	data := map[string]string{"a": "1"}
+	objectMeta := Metav1ObjectMeta{
+		Name:        "settings",
+		Namespace:   "default",
+		Labels:      map[string]string{"app": "web"},
+		Annotations: map[string]string{"team": "a"},
+	}
+
+	tests := []struct {
+		name string
+		want OperationResult
+	}{
+		// The annotation and the owner differ.
+		{"stale", OperationResultUpdated},
+		{"up to date", OperationResultUnchanged},
+	}
+	for _, tt := range tests {
+		result, err := c.CreateOrUpdateConfigMap(ctx, Metav1TypeMeta{}, objectMeta, data)
+		if err != nil {
+			t.Fatalf("%s: CreateOrUpdateConfigMap() error = %v", tt.name, err)
+		}
+		if result != tt.want {
+			t.Errorf("%s: CreateOrUpdateConfigMap() = %s, want %s", tt.name, result, tt.want)
+		}
+	}
+
+	cm, err := c.GetConfigMap(ctx, "settings", "default")
+	if err != nil {
+		t.Fatalf("GetConfigMap() error = %v", err)
+	}
+	if cm.Labels[OwnerLabel] != "release" || cm.Labels["extra"] != "kept" || cm.Annotations["team"] != "a" {
+		t.Errorf("metadata = %v %v, want the owner release, the extra label kept and the team annotation", cm.Labels, cm.Annotations)
+	}
+
+	// Only the labels change.
+	objectMeta.Labels = map[string]string{"app": "api"}
+	result, err := c.CreateOrUpdateConfigMap(ctx, Metav1TypeMeta{}, objectMeta, data)
+	if err != nil {
+		t.Fatalf("CreateOrUpdateConfigMap() error = %v", err)
+	}
+	if result != OperationResultUpdated {
+		t.Errorf("CreateOrUpdateConfigMap() of new labels = %s, want %s", result, OperationResultUpdated)
+	}
+
+}
+
+func TestCreateOrUpdatePVCMetadata(t *testing.T) {
+
+	ctx := context.Background()
+	c := NewClientFromClientset(fake.NewSimpleClientset(&v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+	}), WithOwner("release"))
+
+	objectMeta := Metav1ObjectMeta{Name: "data", Namespace: "default", Labels: map[string]string{"app": "db"}}
+	accessMode := PersistentVolumeAccessMode{ReadWriteOnce: true}
+
+	result, err := c.CreateOrUpdatePVC(ctx, Metav1TypeMeta{}, objectMeta, accessMode, "standard", "1Gi")
+	if err != nil {
+		t.Fatalf("CreateOrUpdatePVC() error = %v", err)
+	}
+	if result != OperationResultUpdated {
+		t.Errorf("CreateOrUpdatePVC() = %s, want %s", result, OperationResultUpdated)
+	}
+
+	pvc, err := c.GetPVC(ctx, "data", "default")
+	if err != nil {
+		t.Fatalf("GetPVC() error = %v", err)
+	}
+	if pvc.Labels["app"] != "db" || pvc.Labels[OwnerLabel] != "release" {
+		t.Errorf("labels = %v, want app=db and the owner release", pvc.Labels)
+	}
+
+}
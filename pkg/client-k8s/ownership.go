@@ -0,0 +1,280 @@
+package clientk8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SetOwnerReference adds owner, such as a Deployment returned by GetObject, to
+// the owner references of obj, such as a ConfigMap returned by
+// GenerateConfigMap, so that the garbage collector deletes obj with its
+// owner. A reference to the same owner is replaced.
+//
+// The owner must exist, as its uid is required. A namespaced owner can only
+// own objects of its namespace, so the namespace of obj must be set; a
+// cluster scoped owner can own any object.
+func SetOwnerReference(owner runtime.Object, obj metav1.Object) error {
+	return setOwnerReference(owner, obj, false)
+}
+
+// SetControllerReference adds owner to the owner references of obj as its
+// controller, as SetOwnerReference does. The deletion of owner in the
+// foreground waits for obj to be deleted. An object has at most one
+// controller: obj must not be controlled by another object.
+func SetControllerReference(owner runtime.Object, obj metav1.Object) error {
+	return setOwnerReference(owner, obj, true)
+}
+
+func setOwnerReference(owner runtime.Object, obj metav1.Object, controller bool) error {
+
+	gvk, err := ObjectGVK(owner)
+	if err != nil {
+		return err
+	}
+
+	ownerMeta, ok := owner.(metav1.Object)
+	if !ok {
+		return fmt.Errorf("%T has no object metadata", owner)
+	}
+
+	if ownerMeta.GetName() == "" || ownerMeta.GetUID() == "" {
+		return fmt.Errorf("%s %q has no uid: the owner must be read from the API server", gvk.Kind, ownerMeta.GetName())
+	}
+
+	if ownerMeta.GetNamespace() != "" && ownerMeta.GetNamespace() != obj.GetNamespace() {
+		return fmt.Errorf("%s %s/%s can't own %q in namespace %q: cross-namespace owner references are not allowed",
+			gvk.Kind, ownerMeta.GetNamespace(), ownerMeta.GetName(), obj.GetName(), obj.GetNamespace())
+	}
+
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	reference := metav1.OwnerReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       ownerMeta.GetName(),
+		UID:        ownerMeta.GetUID(),
+	}
+	if controller {
+		reference.Controller = boolPtr(true)
+		reference.BlockOwnerDeletion = boolPtr(true)
+	}
+
+	var references []metav1.OwnerReference
+	for _, existing := range obj.GetOwnerReferences() {
+		if existing.UID == reference.UID {
+			continue
+		}
+		if controller && existing.Controller != nil && *existing.Controller {
+			return fmt.Errorf("%q is already controlled by %s %q", obj.GetName(), existing.Kind, existing.Name)
+		}
+		references = append(references, existing)
+	}
+
+	obj.SetOwnerReferences(append(references, reference))
+
+	return nil
+
+}
+
+// SetOwner adds owner to the owner references of the object identified by
+// kind, name and namespace, as SetOwnerReference does. The object is patched
+// and the patch retried when the object changes concurrently.
+func (c *Client) SetOwner(ctx context.Context, kind, name, namespace string, owner runtime.Object) error {
+	return c.patchOwnerReferences(ctx, kind, name, namespace, owner, false)
+}
+
+// SetController adds owner to the owner references of the object identified
+// by kind, name and namespace as its controller, as SetControllerReference
+// does.
+func (c *Client) SetController(ctx context.Context, kind, name, namespace string, owner runtime.Object) error {
+	return c.patchOwnerReferences(ctx, kind, name, namespace, owner, true)
+}
+
+func (c *Client) patchOwnerReferences(ctx context.Context, kind, name, namespace string, owner runtime.Object, controller bool) error {
+	return c.patchObjectMetadata(ctx, kind, name, namespace, func(obj metav1.Object) (map[string]interface{}, error) {
+		if err := setOwnerReference(owner, obj, controller); err != nil {
+			return nil, newError(OpPatch, kind, obj.GetNamespace(), name, err)
+		}
+		return map[string]interface{}{"ownerReferences": obj.GetOwnerReferences()}, nil
+	})
+}
+
+// AddFinalizer adds finalizer to the object identified by kind, name and
+// namespace, so that its deletion waits until the finalizer is removed. An
+// object that already has the finalizer is left as it is.
+func (c *Client) AddFinalizer(ctx context.Context, kind, name, namespace, finalizer string) error {
+
+	if finalizer == "" {
+		return errors.New("the finalizer is required")
+	}
+
+	return c.patchObjectMetadata(ctx, kind, name, namespace, func(obj metav1.Object) (map[string]interface{}, error) {
+		if containsString(obj.GetFinalizers(), finalizer) {
+			return nil, nil
+		}
+		return map[string]interface{}{"finalizers": append(obj.GetFinalizers(), finalizer)}, nil
+	})
+
+}
+
+// RemoveFinalizer removes finalizer from the object identified by kind, name
+// and namespace, once its cleanup is done. An object without the finalizer,
+// or already deleted, is left as it is.
+func (c *Client) RemoveFinalizer(ctx context.Context, kind, name, namespace, finalizer string) error {
+
+	err := c.patchObjectMetadata(ctx, kind, name, namespace, func(obj metav1.Object) (map[string]interface{}, error) {
+		if !containsString(obj.GetFinalizers(), finalizer) {
+			return nil, nil
+		}
+		finalizers := []string{}
+		for _, existing := range obj.GetFinalizers() {
+			if existing != finalizer {
+				finalizers = append(finalizers, existing)
+			}
+		}
+		return map[string]interface{}{"finalizers": finalizers}, nil
+	})
+
+	if IsNotFound(err) {
+		return nil
+	}
+
+	return err
+
+}
+
+// HasFinalizer reports whether the object identified by kind, name and
+// namespace has finalizer.
+func (c *Client) HasFinalizer(ctx context.Context, kind, name, namespace, finalizer string) (bool, error) {
+
+	obj, err := c.getObjectMetadata(ctx, kind, name, c.kindNamespace(kind, namespace))
+	if err != nil {
+		return false, err
+	}
+
+	return containsString(obj.GetFinalizers(), finalizer), nil
+
+}
+
+// patchObjectMetadata reads the object, passes its metadata to change and
+// sends the metadata fields change returns as a JSON merge patch. The patch
+// only succeeds while the object is at the resourceVersion read, and the
+// sequence is retried on conflicts. Nothing is sent when change returns no
+// fields.
+func (c *Client) patchObjectMetadata(ctx context.Context, kind, name, namespace string, change func(metav1.Object) (map[string]interface{}, error)) error {
+
+	namespace = c.kindNamespace(kind, namespace)
+
+	return c.retryOnConflict(ctx, OpPatch, kind, namespace, name, func(ctx context.Context) error {
+		obj, err := c.getObjectMetadata(ctx, kind, name, namespace)
+		if err != nil {
+			return err
+		}
+
+		metadata, err := change(obj)
+		if err != nil || metadata == nil {
+			return err
+		}
+
+		metadata["resourceVersion"] = obj.GetResourceVersion()
+
+		patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+		if err != nil {
+			return err
+		}
+
+		return c.Patch(ctx, kind, name, namespace, types.MergePatchType, patch)
+	})
+
+}
+
+// kindNamespace returns the namespace of an object of kind: none for cluster
+// scoped kinds, or namespace resolved by the client.
+func (c *Client) kindNamespace(kind, namespace string) string {
+	if isClusterScoped(kind) {
+		return ""
+	}
+	return c.resolveNamespace(namespace)
+}
+
+// getObjectMetadata returns the object identified by kind, name and namespace.
+func (c *Client) getObjectMetadata(ctx context.Context, kind, name, namespace string) (metav1.Object, error) {
+
+	switch kind {
+	case KindConfigMap:
+		return c.GetConfigMap(ctx, name, namespace)
+	case KindSecret:
+		return c.GetSecret(ctx, name, namespace)
+	case KindRole:
+		return c.GetRole(ctx, name, namespace)
+	case KindRoleBinding:
+		return c.GetRoleBinding(ctx, name, namespace)
+	case KindClusterRole:
+		return c.GetClusterRole(ctx, name)
+	case KindClusterRoleBinding:
+		return c.GetClusterRoleBinding(ctx, name)
+	case KindServiceAccount:
+		return c.GetServiceAccount(ctx, name, namespace)
+	case KindPersistentVolumeClaim:
+		return c.GetPVC(ctx, name, namespace)
+	case KindNamespace:
+		return c.GetNamespace(ctx, name)
+	case KindDeployment:
+		var result metav1.Object
+		err := c.do(ctx, OpGet, KindDeployment, namespace, name, func(ctx context.Context) error {
+			var err error
+			result, err = c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	default:
+		return nil, newError(OpGet, kind, namespace, name, fmt.Errorf("unsupported kind %q", kind))
+	}
+
+}
+
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+func boolPtr(value bool) *bool {
+	return &value
+}
+
+// SetOwner calls Client.SetOwner on the default client.
+func SetOwner(kind, name, namespace string, owner runtime.Object) error {
+	return defaultClient().SetOwner(context.Background(), kind, name, namespace, owner)
+}
+
+// SetController calls Client.SetController on the default client.
+func SetController(kind, name, namespace string, owner runtime.Object) error {
+	return defaultClient().SetController(context.Background(), kind, name, namespace, owner)
+}
+
+// AddFinalizer calls Client.AddFinalizer on the default client.
+func AddFinalizer(kind, name, namespace, finalizer string) error {
+	return defaultClient().AddFinalizer(context.Background(), kind, name, namespace, finalizer)
+}
+
+// RemoveFinalizer calls Client.RemoveFinalizer on the default client.
+func RemoveFinalizer(kind, name, namespace, finalizer string) error {
+	return defaultClient().RemoveFinalizer(context.Background(), kind, name, namespace, finalizer)
+}
+
+// HasFinalizer calls Client.HasFinalizer on the default client.
+func HasFinalizer(kind, name, namespace, finalizer string) (bool, error) {
+	return defaultClient().HasFinalizer(context.Background(), kind, name, namespace, finalizer)
+}
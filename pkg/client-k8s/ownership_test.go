@@ -0,0 +1,171 @@
+package clientk8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func deployment(name, namespace, uid string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(uid)}}
+}
+
+func TestSetOwnerReference(t *testing.T) {
+
+	controlled := func() *v1.ConfigMap {
+		obj := configMap("settings", "1")
+		SetControllerReference(deployment("web", "default", "web-uid"), obj)
+		return obj
+	}
+
+	tests := []struct {
+		name       string
+		obj        *v1.ConfigMap
+		owner      runtime.Object
+		controller bool
+		wantErr    bool
+		wantOwners []string
+	}{
+		{"owner", configMap("settings", "1"), deployment("web", "default", "web-uid"), false, false, []string{"web"}},
+		{"no uid", configMap("settings", "1"), deployment("web", "default", ""), false, true, nil},
+		{"other namespace", configMap("settings", "1"), deployment("web", "other", "web-uid"), false, true, nil},
+		{"cluster scoped owner", configMap("settings", "1"), &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", UID: "apps-uid"}}, false, false, []string{"apps"}},
+		{"second owner", controlled(), deployment("api", "default", "api-uid"), false, false, []string{"web", "api"}},
+		{"second controller", controlled(), deployment("api", "default", "api-uid"), true, true, []string{"web"}},
+		{"same controller", controlled(), deployment("web", "default", "web-uid"), true, false, []string{"web"}},
+	}
+	for _, tt := range tests {
+		var err error
+		if tt.controller {
+			err = SetControllerReference(tt.owner, tt.obj)
+		} else {
+			err = SetOwnerReference(tt.owner, tt.obj)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+
+		var owners []string
+		for _, reference := range tt.obj.OwnerReferences {
+			owners = append(owners, reference.Name)
+		}
+		if !reflect.DeepEqual(owners, tt.wantOwners) {
+			t.Errorf("%s: owners = %v, want %v", tt.name, owners, tt.wantOwners)
+		}
+	}
+
+	obj := controlled()
+	if reference := obj.OwnerReferences[0]; reference.Kind != KindDeployment || reference.APIVersion != "apps/v1" || !*reference.Controller || !*reference.BlockOwnerDeletion {
+		t.Errorf("controller reference = %+v, want a blocking apps/v1 Deployment controller", reference)
+	}
+
+}
+
+func TestSetController(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(configMap("settings", "1"))
+	c := NewClientFromClientset(clientset)
+	ctx := context.Background()
+
+	if err := c.SetController(ctx, KindConfigMap, "settings", "default", deployment("web", "default", "web-uid")); err != nil {
+		t.Fatalf("SetController() error = %v", err)
+	}
+
+	got, err := c.GetConfigMap(ctx, "settings", "default")
+	if err != nil {
+		t.Fatalf("GetConfigMap() error = %v", err)
+	}
+	if controller := metav1.GetControllerOf(got); controller == nil || controller.UID != "web-uid" {
+		t.Errorf("controller = %+v, want the deployment", controller)
+	}
+
+	if err := c.SetController(ctx, KindConfigMap, "settings", "default", deployment("api", "default", "api-uid")); err == nil {
+		t.Error("SetController() of a controlled object returned no error")
+	}
+
+}
+
+func TestFinalizers(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset(configMap("settings", "1")))
+	ctx := context.Background()
+	finalizer := "example.com/cleanup"
+
+	for i := 0; i < 2; i++ {
+		if err := c.AddFinalizer(ctx, KindConfigMap, "settings", "default", finalizer); err != nil {
+			t.Fatalf("AddFinalizer() error = %v", err)
+		}
+	}
+	got, err := c.GetConfigMap(ctx, "settings", "default")
+	if err != nil {
+		t.Fatalf("GetConfigMap() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Finalizers, []string{finalizer}) {
+		t.Errorf("finalizers = %v, want it once", got.Finalizers)
+	}
+	if has, err := c.HasFinalizer(ctx, KindConfigMap, "settings", "default", finalizer); err != nil || !has {
+		t.Errorf("HasFinalizer() = %v, %v, want true", has, err)
+	}
+
+	if err := c.RemoveFinalizer(ctx, KindConfigMap, "settings", "default", finalizer); err != nil {
+		t.Fatalf("RemoveFinalizer() error = %v", err)
+	}
+	if has, err := c.HasFinalizer(ctx, KindConfigMap, "settings", "default", finalizer); err != nil || has {
+		t.Errorf("HasFinalizer() after RemoveFinalizer() = %v, %v, want false", has, err)
+	}
+
+	// Removing it from a deleted object is done.
+	if err := c.RemoveFinalizer(ctx, KindConfigMap, "deleted", "default", finalizer); err != nil {
+		t.Errorf("RemoveFinalizer() of a missing object error = %v", err)
+	}
+	if err := c.AddFinalizer(ctx, KindConfigMap, "settings", "default", ""); err == nil {
+		t.Error("AddFinalizer() without a finalizer returned no error")
+	}
+
+}
+
+func TestAddFinalizerRetriesConflicts(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(configMap("settings", "1"))
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	// The first patch loses a race with another finalizer.
+	patches := 0
+	clientset.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches++
+		if patches > 1 {
+			return false, nil, nil
+		}
+		concurrent := configMap("settings", "2")
+		concurrent.Finalizers = []string{"example.com/other"}
+		if err := clientset.Tracker().Update(gvr, concurrent, "default"); err != nil {
+			t.Fatalf("updating the config map: %v", err)
+		}
+		return true, nil, apierrors.NewConflict(configMaps, "settings", errors.New("changed"))
+	})
+
+	c := NewClientFromClientset(clientset)
+	if err := c.AddFinalizer(context.Background(), KindConfigMap, "settings", "default", "example.com/cleanup"); err != nil {
+		t.Fatalf("AddFinalizer() error = %v", err)
+	}
+
+	got, err := c.GetConfigMap(context.Background(), "settings", "default")
+	if err != nil {
+		t.Fatalf("GetConfigMap() error = %v", err)
+	}
+	if want := []string{"example.com/other", "example.com/cleanup"}; patches != 2 || !reflect.DeepEqual(got.Finalizers, want) {
+		t.Errorf("finalizers = %v after %d patches, want %v after a retry", got.Finalizers, patches, want)
+	}
+
+}
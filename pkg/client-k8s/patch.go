@@ -0,0 +1,184 @@
+package clientk8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// JSONPatchOperation is a single RFC 6902 JSON patch operation.
+type JSONPatchOperation struct {
+	// add, remove, replace, move, copy or test
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Patch sends a patch of the given type to the object identified by kind,
+// name and namespace. The namespace is ignored for cluster scoped kinds.
+func (c *Client) Patch(ctx context.Context, kind, name, namespace string, patchType types.PatchType, data []byte) error {
+
+	if isClusterScoped(kind) {
+		namespace = ""
+	} else {
+		namespace = c.resolveNamespace(namespace)
+	}
+
+	return c.do(ctx, OpPatch, kind, namespace, name, func(ctx context.Context) error {
+		var err error
+
+		switch kind {
+		case KindConfigMap:
+			_, err = c.clientset.CoreV1().ConfigMaps(namespace).Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindSecret:
+			_, err = c.clientset.CoreV1().Secrets(namespace).Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindRole:
+			_, err = c.clientset.RbacV1().Roles(namespace).Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindRoleBinding:
+			_, err = c.clientset.RbacV1().RoleBindings(namespace).Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindClusterRole:
+			_, err = c.clientset.RbacV1().ClusterRoles().Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindClusterRoleBinding:
+			_, err = c.clientset.RbacV1().ClusterRoleBindings().Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindServiceAccount:
+			_, err = c.clientset.CoreV1().ServiceAccounts(namespace).Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindPersistentVolumeClaim:
+			_, err = c.clientset.CoreV1().PersistentVolumeClaims(namespace).Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindNamespace:
+			_, err = c.clientset.CoreV1().Namespaces().Patch(ctx, name, patchType, data, c.patchOptions())
+		case KindDeployment:
+			_, err = c.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, patchType, data, c.patchOptions())
+		default:
+			err = fmt.Errorf("unsupported kind %q", kind)
+		}
+
+		return err
+	})
+
+}
+
+// PatchJSON applies the JSON patch operations to the object.
+func (c *Client) PatchJSON(ctx context.Context, kind, name, namespace string, operations []JSONPatchOperation) error {
+
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, kind, name, namespace, types.JSONPatchType, data)
+
+}
+
+// SetLabels adds or overwrites the given labels, leaving the others as they
+// are.
+func (c *Client) SetLabels(ctx context.Context, kind, name, namespace string, labels map[string]string) error {
+	return c.patchMetadata(ctx, kind, name, namespace, "labels", stringValues(labels))
+}
+
+// RemoveLabels removes the given label keys. Missing keys are ignored.
+func (c *Client) RemoveLabels(ctx context.Context, kind, name, namespace string, keys []string) error {
+	return c.patchMetadata(ctx, kind, name, namespace, "labels", nullValues(keys))
+}
+
+// SetAnnotations adds or overwrites the given annotations, leaving the others
+// as they are.
+func (c *Client) SetAnnotations(ctx context.Context, kind, name, namespace string, annotations map[string]string) error {
+	return c.patchMetadata(ctx, kind, name, namespace, "annotations", stringValues(annotations))
+}
+
+// RemoveAnnotations removes the given annotation keys. Missing keys are
+// ignored.
+func (c *Client) RemoveAnnotations(ctx context.Context, kind, name, namespace string, keys []string) error {
+	return c.patchMetadata(ctx, kind, name, namespace, "annotations", nullValues(keys))
+}
+
+// patchMetadata sends a JSON merge patch for one of the metadata maps.
+func (c *Client) patchMetadata(ctx context.Context, kind, name, namespace, field string, values map[string]interface{}) error {
+
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			field: values,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, kind, name, namespace, types.MergePatchType, data)
+
+}
+
+// mergePatchWithResourceVersion builds a JSON merge patch that only succeeds
+// while the object is still at resourceVersion, so read-modify-write patches
+// of lists fail with a conflict instead of dropping concurrent changes.
+func mergePatchWithResourceVersion(resourceVersion string, fields map[string]interface{}) ([]byte, error) {
+
+	fields["metadata"] = map[string]interface{}{
+		"resourceVersion": resourceVersion,
+	}
+
+	return json.Marshal(fields)
+
+}
+
+func stringValues(values map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
+
+// nullValues maps every key to null, which deletes it in a merge patch.
+func nullValues(keys []string) map[string]interface{} {
+	result := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		result[key] = nil
+	}
+	return result
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Patch calls Client.Patch on the default client.
+func Patch(kind, name, namespace string, patchType types.PatchType, data []byte) error {
+	return defaultClient().Patch(context.Background(), kind, name, namespace, patchType, data)
+}
+
+// PatchJSON calls Client.PatchJSON on the default client.
+func PatchJSON(kind, name, namespace string, operations []JSONPatchOperation) error {
+	return defaultClient().PatchJSON(context.Background(), kind, name, namespace, operations)
+}
+
+// SetLabels calls Client.SetLabels on the default client.
+func SetLabels(kind, name, namespace string, labels map[string]string) error {
+	return defaultClient().SetLabels(context.Background(), kind, name, namespace, labels)
+}
+
+// RemoveLabels calls Client.RemoveLabels on the default client.
+func RemoveLabels(kind, name, namespace string, keys []string) error {
+	return defaultClient().RemoveLabels(context.Background(), kind, name, namespace, keys)
+}
+
+// SetAnnotations calls Client.SetAnnotations on the default client.
+func SetAnnotations(kind, name, namespace string, annotations map[string]string) error {
+	return defaultClient().SetAnnotations(context.Background(), kind, name, namespace, annotations)
+}
+
+// RemoveAnnotations calls Client.RemoveAnnotations on the default client.
+func RemoveAnnotations(kind, name, namespace string, keys []string) error {
+	return defaultClient().RemoveAnnotations(context.Background(), kind, name, namespace, keys)
+}
@@ -0,0 +1,228 @@
+package clientk8s
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	readRule  = Rbacv1PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list"}}
+	writeRule = Rbacv1PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"update"}}
+	alice     = Rbacv1Subject{Kind: "User", APIGroup: "rbac.authorization.k8s.io", Name: "alice"}
+	builder   = Rbacv1Subject{Kind: "ServiceAccount", Name: "builder", Namespace: "default"}
+)
+
+func TestPatchConfigMapKeys(t *testing.T) {
+
+	ctx := context.Background()
+	c := NewClientFromClientset(fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+		Data:       map[string]string{"a": "1", "b": "2"},
+	}))
+
+	if err := c.PatchConfigMapKeys(ctx, "settings", "default", map[string]string{"b": "20", "c": "3"}); err != nil {
+		t.Fatalf("PatchConfigMapKeys() error = %v", err)
+	}
+	assertConfigMapData(t, c, map[string]string{"a": "1", "b": "20", "c": "3"})
+
+	if err := c.RemoveConfigMapKeys(ctx, "settings", "default", []string{"a", "missing"}); err != nil {
+		t.Fatalf("RemoveConfigMapKeys() error = %v", err)
+	}
+	assertConfigMapData(t, c, map[string]string{"b": "20", "c": "3"})
+
+}
+
+func assertConfigMapData(t *testing.T, c *Client, want map[string]string) {
+
+	t.Helper()
+
+	cm, err := c.GetConfigMap(context.Background(), "settings", "default")
+	if err != nil {
+		t.Fatalf("GetConfigMap() error = %v", err)
+	}
+	if !reflect.DeepEqual(cm.Data, want) {
+		t.Fatalf("data = %v, want %v", cm.Data, want)
+	}
+
+}
+
+func TestAddRemoveRoleRules(t *testing.T) {
+
+	ctx := context.Background()
+	c := NewClientFromClientset(fake.NewSimpleClientset(&rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default"},
+		Rules:      policyRulesFrom([]Rbacv1PolicyRule{readRule}),
+	}))
+
+	// Adding a rule twice keeps a single copy.
+	for i := 0; i < 2; i++ {
+		if err := c.AddRoleRules(ctx, "reader", "default", []Rbacv1PolicyRule{writeRule}); err != nil {
+			t.Fatalf("AddRoleRules() error = %v", err)
+		}
+	}
+	assertRoleRules(t, c, []Rbacv1PolicyRule{readRule, writeRule})
+
+	if err := c.RemoveRoleRules(ctx, "reader", "default", []Rbacv1PolicyRule{readRule}); err != nil {
+		t.Fatalf("RemoveRoleRules() error = %v", err)
+	}
+	assertRoleRules(t, c, []Rbacv1PolicyRule{writeRule})
+
+}
+
+func TestAddRoleRulesRetriesOnConflict(t *testing.T) {
+
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default", ResourceVersion: "1"},
+		Rules:      policyRulesFrom([]Rbacv1PolicyRule{readRule}),
+	})
+	c := NewClientFromClientset(clientset)
+
+	// The first patch loses the race against a writer removing every rule,
+	// and the API server rejects it as its resourceVersion is stale.
+	var resourceVersions []string
+	clientset.PrependReactor("patch", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var patch struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &patch); err != nil {
+			t.Fatalf("invalid patch: %v", err)
+		}
+		resourceVersions = append(resourceVersions, patch.Metadata.ResourceVersion)
+		if len(resourceVersions) > 1 {
+			return false, nil, nil
+		}
+
+		err := clientset.Tracker().Update(schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, &rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default", ResourceVersion: "2"},
+		}, "default")
+		if err != nil {
+			t.Fatalf("updating the role: %v", err)
+		}
+
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "rbac.authorization.k8s.io", Resource: "roles"}, "reader", nil)
+	})
+
+	if err := c.AddRoleRules(ctx, "reader", "default", []Rbacv1PolicyRule{writeRule}); err != nil {
+		t.Fatalf("AddRoleRules() error = %v", err)
+	}
+
+	if want := []string{"1", "2"}; !reflect.DeepEqual(resourceVersions, want) {
+		t.Fatalf("patched resourceVersions = %v, want %v", resourceVersions, want)
+	}
+
+	// The retry started from the role as changed by the other writer.
+	assertRoleRules(t, c, []Rbacv1PolicyRule{writeRule})
+
+}
+
+func assertRoleRules(t *testing.T, c *Client, want []Rbacv1PolicyRule) {
+
+	t.Helper()
+
+	role, err := c.GetRole(context.Background(), "reader", "default")
+	if err != nil {
+		t.Fatalf("GetRole() error = %v", err)
+	}
+	if !reflect.DeepEqual(role.Rules, policyRulesFrom(want)) {
+		t.Fatalf("rules = %+v, want %+v", role.Rules, policyRulesFrom(want))
+	}
+
+}
+
+func TestAddRemoveRoleBindingSubjects(t *testing.T) {
+
+	ctx := context.Background()
+	c := NewClientFromClientset(fake.NewSimpleClientset(&rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "readers", Namespace: "default"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "reader"},
+		Subjects:   subjectsFrom([]Rbacv1Subject{alice}),
+	}))
+
+	for i := 0; i < 2; i++ {
+		if err := c.AddSubjectsToRoleBinding(ctx, "readers", "default", []Rbacv1Subject{builder}); err != nil {
+			t.Fatalf("AddSubjectsToRoleBinding() error = %v", err)
+		}
+	}
+	assertSubjects(t, c, []Rbacv1Subject{alice, builder})
+
+	if err := c.RemoveSubjectsFromRoleBinding(ctx, "readers", "default", []Rbacv1Subject{alice}); err != nil {
+		t.Fatalf("RemoveSubjectsFromRoleBinding() error = %v", err)
+	}
+	assertSubjects(t, c, []Rbacv1Subject{builder})
+
+}
+
+func assertSubjects(t *testing.T, c *Client, want []Rbacv1Subject) {
+
+	t.Helper()
+
+	roleBinding, err := c.GetRoleBinding(context.Background(), "readers", "default")
+	if err != nil {
+		t.Fatalf("GetRoleBinding() error = %v", err)
+	}
+	if !reflect.DeepEqual(roleBinding.Subjects, subjectsFrom(want)) {
+		t.Fatalf("subjects = %+v, want %+v", roleBinding.Subjects, subjectsFrom(want))
+	}
+
+}
+
+func TestSetLabelsAndAnnotations(t *testing.T) {
+
+	ctx := context.Background()
+	c := NewClientFromClientset(fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "token",
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "web", "tier": "front"},
+			Annotations: map[string]string{"owner": "team-a"},
+		},
+	}))
+
+	if err := c.SetLabels(ctx, KindSecret, "token", "default", map[string]string{"tier": "back", "env": "prod"}); err != nil {
+		t.Fatalf("SetLabels() error = %v", err)
+	}
+	if err := c.RemoveLabels(ctx, KindSecret, "token", "default", []string{"app"}); err != nil {
+		t.Fatalf("RemoveLabels() error = %v", err)
+	}
+	if err := c.SetAnnotations(ctx, KindSecret, "token", "default", map[string]string{"rotated": "yes"}); err != nil {
+		t.Fatalf("SetAnnotations() error = %v", err)
+	}
+	if err := c.RemoveAnnotations(ctx, KindSecret, "token", "default", []string{"owner"}); err != nil {
+		t.Fatalf("RemoveAnnotations() error = %v", err)
+	}
+
+	secret, err := c.GetSecret(ctx, "token", "default")
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if want := map[string]string{"tier": "back", "env": "prod"}; !reflect.DeepEqual(secret.Labels, want) {
+		t.Errorf("labels = %v, want %v", secret.Labels, want)
+	}
+	if want := map[string]string{"rotated": "yes"}; !reflect.DeepEqual(secret.Annotations, want) {
+		t.Errorf("annotations = %v, want %v", secret.Annotations, want)
+	}
+
+}
+
+func TestPatchUnsupportedKind(t *testing.T) {
+
+	c := NewClientFromClientset(fake.NewSimpleClientset())
+
+	err := c.SetLabels(context.Background(), "Pod", "web", "default", map[string]string{"app": "web"})
+	if err == nil {
+		t.Fatal("SetLabels() on an unsupported kind returned no error")
+	}
+
+}
@@ -2,23 +2,19 @@ package clientk8s
 
 import (
 	"context"
-	"log"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 )
 
-func CreatePVC(
-	typeMeta Metav1TypeMeta,
-	objectMeta Metav1ObjectMeta,
-	volumeAccessMode PersistentVolumeAccessMode,
-	storageClassName string,
-	resourceMustParse string,
-) error {
-
-	context := context.Background()
+// accessModesFrom converts the access modes set in volumeAccessMode into
+// core/v1 access modes.
+func accessModesFrom(volumeAccessMode PersistentVolumeAccessMode) []corev1.PersistentVolumeAccessMode {
 
 	var persistentVolumeAccessModeItems []corev1.PersistentVolumeAccessMode
 
@@ -34,8 +30,22 @@ func CreatePVC(
 		persistentVolumeAccessModeItems = append(persistentVolumeAccessModeItems, corev1.ReadWriteMany)
 	}
 
+	return persistentVolumeAccessModeItems
+
+}
+
+// GeneratePVC returns the persistent volume claim CreatePVC creates, without
+// sending it to the API server.
+func GeneratePVC(
+	typeMeta Metav1TypeMeta,
+	objectMeta Metav1ObjectMeta,
+	volumeAccessMode PersistentVolumeAccessMode,
+	storageClassName string,
+	resourceMustParse string,
+) *corev1.PersistentVolumeClaim {
+
 	pvcSpec := corev1.PersistentVolumeClaimSpec{
-		AccessModes: persistentVolumeAccessModeItems,
+		AccessModes: accessModesFrom(volumeAccessMode),
 		Resources: corev1.ResourceRequirements{
 			Requests: corev1.ResourceList{
 				corev1.ResourceStorage: resource.MustParse(resourceMustParse),
@@ -44,11 +54,8 @@ func CreatePVC(
 		StorageClassName: &storageClassName,
 	}
 
-	pvc := corev1.PersistentVolumeClaim{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return &corev1.PersistentVolumeClaim{
+		TypeMeta: typeMeta.withDefaults(KindPersistentVolumeClaim, "v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -58,27 +65,42 @@ func CreatePVC(
 		Spec: pvcSpec,
 	}
 
-	log.Println("error")
+}
+
+func (c *Client) CreatePVC(
+	ctx context.Context,
+	typeMeta Metav1TypeMeta,
+	objectMeta Metav1ObjectMeta,
+	volumeAccessMode PersistentVolumeAccessMode,
+	storageClassName string,
+	resourceMustParse string,
+) error {
 
-	_, err = k8sClientSet.CoreV1().PersistentVolumeClaims(objectMeta.Namespace).Create(context, &pvc, metav1.CreateOptions{})
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
 
-	if err != nil {
-		log.Printf("Error creating pvc: %v \n", err)
-		return err
-	}
+	pvc := GeneratePVC(typeMeta, objectMeta, volumeAccessMode, storageClassName, resourceMustParse)
+	c.labelOwner(pvc)
 
-	return nil
+	return c.do(ctx, OpCreate, KindPersistentVolumeClaim, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().PersistentVolumeClaims(objectMeta.Namespace).Create(ctx, pvc, c.createOptions())
+		return err
+	})
 
 }
 
-func GetPVC(name, namespace string) (*corev1.PersistentVolumeClaim, error) {
+func (c *Client) GetPVC(ctx context.Context, name, namespace string) (*corev1.PersistentVolumeClaim, error) {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	result, err := k8sClientSet.CoreV1().PersistentVolumeClaims(namespace).Get(context, name, metav1.GetOptions{})
+	var result *corev1.PersistentVolumeClaim
+
+	err := c.do(ctx, OpGet, KindPersistentVolumeClaim, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting PVC: %v \n", err)
 		return nil, err
 	}
 
@@ -86,31 +108,19 @@ func GetPVC(name, namespace string) (*corev1.PersistentVolumeClaim, error) {
 
 }
 
-func UpdatePVC(
+func (c *Client) UpdatePVC(
+	ctx context.Context,
 	objPVC *corev1.PersistentVolumeClaim,
 	volumeAccessMode PersistentVolumeAccessMode,
 	storageClassName string,
 	resourceMustParse string,
 ) error {
 
-	context := context.Background()
-
-	var persistentVolumeAccessModeItems []corev1.PersistentVolumeAccessMode
-
-	if volumeAccessMode.ReadWriteOnce {
-		persistentVolumeAccessModeItems = append(persistentVolumeAccessModeItems, corev1.ReadWriteOnce)
-	}
-
-	if volumeAccessMode.ReadOnlyMany {
-		persistentVolumeAccessModeItems = append(persistentVolumeAccessModeItems, corev1.ReadOnlyMany)
-	}
-
-	if volumeAccessMode.ReadWriteMany {
-		persistentVolumeAccessModeItems = append(persistentVolumeAccessModeItems, corev1.ReadWriteMany)
-	}
+	objPVC.Namespace = c.resolveNamespace(objPVC.Namespace)
+	c.labelOwner(objPVC)
 
 	pvcSpec := corev1.PersistentVolumeClaimSpec{
-		AccessModes: persistentVolumeAccessModeItems,
+		AccessModes: accessModesFrom(volumeAccessMode),
 		Resources: corev1.ResourceRequirements{
 			Requests: corev1.ResourceList{
 				corev1.ResourceStorage: resource.MustParse(resourceMustParse),
@@ -122,25 +132,26 @@ func UpdatePVC(
 	// Is inmutable - Error
 	objPVC.Spec = pvcSpec
 
-	_, err := k8sClientSet.CoreV1().PersistentVolumeClaims(objPVC.ObjectMeta.Namespace).Update(context, objPVC, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating PVC: %v \n", err)
+	return c.do(ctx, OpUpdate, KindPersistentVolumeClaim, objPVC.Namespace, objPVC.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().PersistentVolumeClaims(objPVC.ObjectMeta.Namespace).Update(ctx, objPVC, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListPVC(namespace string) (*corev1.PersistentVolumeClaimList, error) {
+func (c *Client) ListPVC(ctx context.Context, namespace string, listOptions ListOptions) (*corev1.PersistentVolumeClaimList, error) {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	result, err := k8sClientSet.CoreV1().PersistentVolumeClaims(namespace).List(context, metav1.ListOptions{})
+	var result *corev1.PersistentVolumeClaimList
+
+	err := c.do(ctx, OpList, KindPersistentVolumeClaim, namespace, "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().PersistentVolumeClaims(listNamespace(namespace)).List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list PVCs: %v \n", err)
 		return nil, err
 	}
 
@@ -148,59 +159,218 @@ func ListPVC(namespace string) (*corev1.PersistentVolumeClaimList, error) {
 
 }
 
-func DeletePVC(name, namespace string) error {
+// EachPVC calls fn for every pvc matching listOptions, fetching them page by
+// page. It stops at the first error returned by fn.
+func (c *Client) EachPVC(ctx context.Context, namespace string, listOptions ListOptions, fn func(*corev1.PersistentVolumeClaim) error) error {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	deletePolicy := metav1.DeletePropagationForeground
+	return c.each(ctx, KindPersistentVolumeClaim, namespace, listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.CoreV1().PersistentVolumeClaims(listNamespace(namespace)).List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*corev1.PersistentVolumeClaim))
+	})
+
+}
+
+// PVCEvent is a change of a pvc reported by WatchPVC.
+type PVCEvent struct {
+	Type                  EventType
+	PersistentVolumeClaim *corev1.PersistentVolumeClaim
+}
 
-	err := k8sClientSet.CoreV1().PersistentVolumeClaims(namespace).Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+// WatchPVC calls fn for every change of the pvcs matching listOptions, until
+// ctx is cancelled or fn returns an error. It starts with an Added event per
+// existing pvc, unless listOptions.ResourceVersion is set, and resumes from
+// the last resourceVersion when the connection drops.
+func (c *Client) WatchPVC(ctx context.Context, namespace string, listOptions ListOptions, fn func(PVCEvent) error) error {
+
+	namespace = c.resolveNamespace(namespace)
+
+	return c.watch(ctx, KindPersistentVolumeClaim, namespace, listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.CoreV1().PersistentVolumeClaims(listNamespace(namespace)).List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.CoreV1().PersistentVolumeClaims(listNamespace(namespace)).Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(PVCEvent{Type: eventType, PersistentVolumeClaim: obj.(*corev1.PersistentVolumeClaim)})
 	})
 
-	if err != nil {
-		log.Printf("Error delete PVC: %v \n", err)
-		return err
-	}
+}
+
+func (c *Client) DeletePVC(ctx context.Context, name, namespace string) error {
 
-	return nil
+	namespace = c.resolveNamespace(namespace)
+
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindPersistentVolumeClaim, namespace, name, func(ctx context.Context) error {
+		return c.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdatePVC(
+// CreateOrUpdatePVC creates the pvc when it does not exist. The spec of an
+// existing claim is immutable, so only its labels and annotations are
+// updated.
+func (c *Client) CreateOrUpdatePVC(
+	ctx context.Context,
 	typeMeta Metav1TypeMeta,
 	objectMeta Metav1ObjectMeta,
 	volumeAccessMode PersistentVolumeAccessMode,
 	storageClassName string,
 	resourceMustParse string,
-) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetPVC(objectMeta.Name, objectMeta.Namespace)
-		if getErr != nil {
-			log.Printf("Error getting PVC: %v \n", err)
-			// return err
+) (OperationResult, error) {
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindPersistentVolumeClaim, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetPVC(ctx, objectMeta.Name, objectMeta.Namespace)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
-		if resultGet != nil {
-			/*
-				log.Println("Actualizando PVC")
-				err := UpdatePVC(resultGet, volumeAccessMode, storageClassName, resourceMustParse)
-				if err != nil {
-					log.Printf("Error updating PVC: %v \n", err)
-					return err
-				}
-			*/
-		} else {
-			log.Println("Creando PVC")
-			err := CreatePVC(typeMeta, objectMeta, volumeAccessMode, storageClassName, resourceMustParse)
+
+		if getErr == nil {
+			if c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			c.labelOwner(resultGet)
+			err := c.do(ctx, OpUpdate, KindPersistentVolumeClaim, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+				_, err := c.clientset.CoreV1().PersistentVolumeClaims(objectMeta.Namespace).Update(ctx, resultGet, c.updateOptions())
+				return err
+			})
 			if err != nil {
-				log.Printf("Error creating PVC: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
+			return nil
 		}
+
+		err := c.CreatePVC(ctx, typeMeta, objectMeta, volumeAccessMode, storageClassName, resourceMustParse)
+		if err != nil {
+			return err
+		}
+		result = OperationResultCreated
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
+	}
+	return result, nil
+}
+
+// ApplyPVC creates or updates the pvc using server-side apply, so only the
+// fields given here are owned by the field manager. The API server still
+// rejects changes to the immutable parts of the spec.
+func (c *Client) ApplyPVC(
+	ctx context.Context,
+	objectMeta Metav1ObjectMeta,
+	volumeAccessMode PersistentVolumeAccessMode,
+	storageClassName string,
+	resourceMustParse string,
+	applyOptions ApplyOptions,
+) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	pvcSpecApply := corev1ac.PersistentVolumeClaimSpec().
+		WithAccessModes(accessModesFrom(volumeAccessMode)...).
+		WithResources(corev1ac.ResourceRequirements().
+			WithRequests(corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse(resourceMustParse),
+			})).
+		WithStorageClassName(storageClassName)
+
+	pvcApply := corev1ac.PersistentVolumeClaim(objectMeta.Name, objectMeta.Namespace).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations).
+		WithSpec(pvcSpecApply)
+
+	labels, annotations, err := c.driftStamps(pvcApply)
+	if err != nil {
+		return newError(OpApply, KindPersistentVolumeClaim, objectMeta.Namespace, objectMeta.Name, err)
 	}
-	return nil
+	pvcApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindPersistentVolumeClaim, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().PersistentVolumeClaims(objectMeta.Namespace).Apply(ctx, pvcApply, c.applyOptions(applyOptions))
+		return applyError(KindPersistentVolumeClaim, objectMeta.Namespace, objectMeta.Name, err)
+	})
+
+}
+
+// CreatePVC calls Client.CreatePVC on the default client.
+func CreatePVC(
+	typeMeta Metav1TypeMeta,
+	objectMeta Metav1ObjectMeta,
+	volumeAccessMode PersistentVolumeAccessMode,
+	storageClassName string,
+	resourceMustParse string,
+) error {
+	return defaultClient().CreatePVC(context.Background(), typeMeta, objectMeta, volumeAccessMode, storageClassName, resourceMustParse)
+}
+
+// GetPVC calls Client.GetPVC on the default client.
+func GetPVC(name, namespace string) (*corev1.PersistentVolumeClaim, error) {
+	return defaultClient().GetPVC(context.Background(), name, namespace)
+}
+
+// UpdatePVC calls Client.UpdatePVC on the default client.
+func UpdatePVC(
+	objPVC *corev1.PersistentVolumeClaim,
+	volumeAccessMode PersistentVolumeAccessMode,
+	storageClassName string,
+	resourceMustParse string,
+) error {
+	return defaultClient().UpdatePVC(context.Background(), objPVC, volumeAccessMode, storageClassName, resourceMustParse)
+}
+
+// ListPVC calls Client.ListPVC on the default client, without list options.
+func ListPVC(namespace string) (*corev1.PersistentVolumeClaimList, error) {
+	return defaultClient().ListPVC(context.Background(), namespace, ListOptions{})
+}
+
+// EachPVC calls Client.EachPVC on the default client.
+func EachPVC(namespace string, listOptions ListOptions, fn func(*corev1.PersistentVolumeClaim) error) error {
+	return defaultClient().EachPVC(context.Background(), namespace, listOptions, fn)
+}
+
+// WatchPVC calls Client.WatchPVC on the default client.
+func WatchPVC(namespace string, listOptions ListOptions, fn func(PVCEvent) error) error {
+	return defaultClient().WatchPVC(context.Background(), namespace, listOptions, fn)
+}
+
+// DeletePVC calls Client.DeletePVC on the default client.
+func DeletePVC(name, namespace string) error {
+	return defaultClient().DeletePVC(context.Background(), name, namespace)
+}
+
+// CreateOrUpdatePVC calls Client.CreateOrUpdatePVC on the default client.
+func CreateOrUpdatePVC(
+	typeMeta Metav1TypeMeta,
+	objectMeta Metav1ObjectMeta,
+	volumeAccessMode PersistentVolumeAccessMode,
+	storageClassName string,
+	resourceMustParse string,
+) (OperationResult, error) {
+	return defaultClient().CreateOrUpdatePVC(context.Background(), typeMeta, objectMeta, volumeAccessMode, storageClassName, resourceMustParse)
+}
+
+// ApplyPVC calls Client.ApplyPVC on the default client.
+func ApplyPVC(
+	objectMeta Metav1ObjectMeta,
+	volumeAccessMode PersistentVolumeAccessMode,
+	storageClassName string,
+	resourceMustParse string,
+	applyOptions ApplyOptions,
+) error {
+	return defaultClient().ApplyPVC(context.Background(), objectMeta, volumeAccessMode, storageClassName, resourceMustParse, applyOptions)
 }
@@ -0,0 +1,186 @@
+package clientk8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// ManifestFormat is the format of the manifests written by WriteManifests.
+type ManifestFormat string
+
+// Formats of the manifests.
+const (
+	ManifestYAML ManifestFormat = "yaml"
+	ManifestJSON ManifestFormat = "json"
+)
+
+// RenderYAML returns the YAML manifest of a typed or unstructured object, as
+// the Generate* functions return. See WriteManifests for what is left out.
+func RenderYAML(obj runtime.Object) ([]byte, error) {
+
+	u, err := manifestObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(u.Object)
+
+}
+
+// RenderJSON returns the indented JSON manifest of a typed or unstructured
+// object. See WriteManifests for what is left out.
+func RenderJSON(obj runtime.Object) ([]byte, error) {
+
+	u, err := manifestObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(u.Object, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+
+}
+
+// WriteManifests writes the manifests of objs to w, for GitOps repositories or
+// to preview what would be applied. The objects are written in the order
+// ApplyManifest applies them: YAML documents are separated by "---", and
+// several JSON objects are wrapped in a v1 List.
+//
+// The apiVersion and kind of typed objects are those registered for their Go
+// type. The status and the fields set by the API server, such as the
+// resourceVersion, uid and managedFields, are left out, as are null fields.
+func WriteManifests(w io.Writer, format ManifestFormat, objs ...runtime.Object) error {
+
+	objects := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		u, err := manifestObject(obj)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, u)
+	}
+
+	sortManifest(objects)
+
+	switch format {
+	case ManifestYAML:
+		return writeYAMLManifests(w, objects)
+	case ManifestJSON:
+		return writeJSONManifests(w, objects)
+	default:
+		return fmt.Errorf("unknown manifest format %q", format)
+	}
+
+}
+
+func writeYAMLManifests(w io.Writer, objects []*unstructured.Unstructured) error {
+
+	for i, u := range objects {
+		data, err := yaml.Marshal(u.Object)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+func writeJSONManifests(w io.Writer, objects []*unstructured.Unstructured) error {
+
+	var content interface{}
+
+	if len(objects) == 1 {
+		content = objects[0].Object
+	} else {
+		items := make([]interface{}, 0, len(objects))
+		for _, u := range objects {
+			items = append(items, u.Object)
+		}
+		content = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      items,
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(content)
+
+}
+
+// manifestObject returns the unstructured manifest of obj.
+func manifestObject(obj runtime.Object) (*unstructured.Unstructured, error) {
+
+	var u *unstructured.Unstructured
+
+	if unstructuredObj, ok := obj.(*unstructured.Unstructured); ok {
+		u = unstructuredObj.DeepCopy()
+	} else {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering %T: %w", obj, err)
+		}
+		u = &unstructured.Unstructured{Object: content}
+
+		// The type meta set by the caller may be empty or wrong.
+		if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil {
+			u.SetGroupVersionKind(gvks[0])
+		}
+	}
+
+	if u.GetAPIVersion() == "" || u.GetKind() == "" {
+		return nil, fmt.Errorf("error rendering %T: apiVersion and kind are required", obj)
+	}
+
+	unstructured.RemoveNestedField(u.Object, "status")
+	for _, field := range []string{"creationTimestamp", "resourceVersion", "uid", "generation", "managedFields", "selfLink"} {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+
+	pruneNulls(u.Object)
+
+	return u, nil
+
+}
+
+// pruneNulls removes the null fields of content, such as the creationTimestamp
+// of pod templates.
+func pruneNulls(content map[string]interface{}) {
+
+	for key, value := range content {
+		switch value := value.(type) {
+		case nil:
+			delete(content, key)
+		case map[string]interface{}:
+			pruneNulls(value)
+		case []interface{}:
+			for _, item := range value {
+				if item, ok := item.(map[string]interface{}); ok {
+					pruneNulls(item)
+				}
+			}
+		}
+	}
+
+}
@@ -0,0 +1,190 @@
+package clientk8s
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/retry"
+)
+
+// RetryPolicy configures how requests failing for a transient reason are sent
+// again, and how the CreateOrUpdate* and patch helpers back off after a
+// conflict.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is sent,
+	// including the first one. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialInterval is the wait before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between two attempts.
+	MaxInterval time.Duration
+	// Multiplier grows the wait after every attempt.
+	Multiplier float64
+	// Jitter adds a random wait of up to Jitter times the interval.
+	Jitter float64
+	// MaxElapsedTime stops retrying once the next attempt would start later
+	// than this after the first one. Zero means no limit.
+	MaxElapsedTime time.Duration
+	// Retryable decides which errors are retried. Defaults to IsRetryable:
+	// throttling, timeouts, 5xx errors and dropped connections.
+	Retryable func(error) bool
+	// Conflict is the backoff used to run a CreateOrUpdate* or patch helper
+	// sequence again after a conflict. Defaults to retry.DefaultRetry.
+	Conflict wait.Backoff
+}
+
+// DefaultRetryPolicy returns a policy retrying transient errors up to 5 times
+// with an exponential backoff from 200ms to 5s, within 30s.
+//
+// Clients do not retry transient errors unless WithRetryPolicy is set.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     5,
+		InitialInterval: 200 * time.Millisecond,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  30 * time.Second,
+		Retryable:       IsRetryable,
+		Conflict:        retry.DefaultRetry,
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithQPS sets the maximum number of queries per second sent to the API
+// server. Defaults to the client-go default of 5.
+func WithQPS(qps float32) Option {
+	return func(c *Client) {
+		c.qps = qps
+	}
+}
+
+// WithBurst sets the number of queries allowed above QPS for short periods.
+// Defaults to the client-go default of 10.
+func WithBurst(burst int) Option {
+	return func(c *Client) {
+		c.burst = burst
+	}
+}
+
+// WithTimeout sets the timeout of every HTTP request sent to the API server.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRateLimiter replaces the client-side rate limiter built from QPS and
+// Burst.
+func WithRateLimiter(rateLimiter flowcontrol.RateLimiter) Option {
+	return func(c *Client) {
+		c.rateLimiter = rateLimiter
+	}
+}
+
+// configureRateLimits applies the QPS, burst, timeout and rate limiter
+// options to the config.
+func (c *Client) configureRateLimits(config *rest.Config) {
+
+	if c.qps > 0 {
+		config.QPS = c.qps
+	}
+
+	if c.burst > 0 {
+		config.Burst = c.burst
+	}
+
+	if c.timeout > 0 {
+		config.Timeout = c.timeout
+	}
+
+	if c.rateLimiter != nil {
+		config.RateLimiter = c.rateLimiter
+	}
+
+}
+
+// withRetries calls fn until it succeeds, fails with an error the policy does
+// not retry, or the policy gives up. onRetry is called before every new
+// attempt.
+func (p RetryPolicy) withRetries(ctx context.Context, fn func() error, onRetry func(attempt int, err error)) error {
+
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+
+		wait := p.interval(attempt)
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > wait {
+			wait = time.Duration(seconds) * time.Second
+		}
+
+		if p.MaxElapsedTime > 0 && time.Since(start)+wait > p.MaxElapsedTime {
+			return err
+		}
+
+		onRetry(attempt, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+	}
+
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// interval is the wait after the given attempt.
+func (p RetryPolicy) interval(attempt int) time.Duration {
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	interval := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+
+	if p.Jitter > 0 {
+		interval += interval * p.Jitter * rand.Float64()
+	}
+
+	return time.Duration(interval)
+
+}
+
+// conflictBackoff is the backoff used after a conflict.
+func (p RetryPolicy) conflictBackoff() wait.Backoff {
+	if p.Conflict.Steps == 0 {
+		return retry.DefaultRetry
+	}
+	return p.Conflict
+}
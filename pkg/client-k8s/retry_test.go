@@ -0,0 +1,166 @@
+package clientk8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// fastRetryPolicy retries up to 3 times without waiting noticeably.
+func fastRetryPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 3
+	policy.InitialInterval = time.Millisecond
+	policy.MaxInterval = time.Millisecond
+	return policy
+}
+
+// failingGets returns a client whose config map gets fail with the errors of
+// errs in turn, then succeed, and a function returning the number of gets.
+func failingGets(policy RetryPolicy, errs ...error) (*Client, func() int) {
+
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+	})
+
+	calls := 0
+	clientset.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		if calls <= len(errs) {
+			return true, nil, errs[calls-1]
+		}
+		return false, nil, nil
+	})
+
+	return NewClientFromClientset(clientset, WithRetryPolicy(policy)), func() int { return calls }
+
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+
+	unavailable := apierrors.NewServiceUnavailable("down")
+
+	tests := []struct {
+		name    string
+		errs    []error
+		wantErr bool
+		calls   int
+	}{
+		{"recovers", []error{unavailable, apierrors.NewTooManyRequests("slow down", 0)}, false, 3},
+		{"gives up", []error{unavailable, unavailable, unavailable}, true, 3},
+		{"not retryable", []error{apierrors.NewBadRequest("bad")}, true, 1},
+	}
+	for _, tt := range tests {
+		c, calls := failingGets(fastRetryPolicy(), tt.errs...)
+
+		_, err := c.GetConfigMap(context.Background(), "settings", "default")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: GetConfigMap() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if calls() != tt.calls {
+			t.Errorf("%s: requests = %d, want %d", tt.name, calls(), tt.calls)
+		}
+	}
+
+}
+
+func TestRetryDisabledByDefault(t *testing.T) {
+
+	c, calls := failingGets(RetryPolicy{}, apierrors.NewServiceUnavailable("down"))
+
+	if _, err := c.GetConfigMap(context.Background(), "settings", "default"); err == nil {
+		t.Fatal("GetConfigMap() returned no error")
+	}
+	if calls() != 1 {
+		t.Errorf("requests = %d, want 1", calls())
+	}
+
+}
+
+func TestRetryMaxElapsedTime(t *testing.T) {
+
+	policy := fastRetryPolicy()
+	policy.InitialInterval = time.Second
+	policy.MaxInterval = time.Second
+	policy.MaxElapsedTime = 100 * time.Millisecond
+
+	c, calls := failingGets(policy, apierrors.NewServiceUnavailable("down"))
+
+	start := time.Now()
+	if _, err := c.GetConfigMap(context.Background(), "settings", "default"); err == nil {
+		t.Fatal("GetConfigMap() returned no error")
+	}
+	if calls() != 1 || time.Since(start) > policy.MaxElapsedTime {
+		t.Errorf("requests = %d in %s, want 1 without waiting past the budget", calls(), time.Since(start))
+	}
+
+}
+
+func TestRetryStopsOnContextCancel(t *testing.T) {
+
+	policy := fastRetryPolicy()
+	policy.InitialInterval = time.Minute
+	policy.MaxInterval = time.Minute
+
+	c, calls := failingGets(policy, apierrors.NewServiceUnavailable("down"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.GetConfigMap(ctx, "settings", "default"); err == nil {
+		t.Fatal("GetConfigMap() returned no error")
+	}
+	if calls() != 1 {
+		t.Errorf("requests = %d, want 1", calls())
+	}
+
+}
+
+func TestRetryInterval(t *testing.T) {
+
+	policy := RetryPolicy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+	}
+
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := policy.interval(attempt + 1); got != want {
+			t.Errorf("interval(%d) = %s, want %s", attempt+1, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.interval(2); got < 200*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("interval(2) with jitter = %s, want within [200ms, 300ms]", got)
+		}
+	}
+
+}
+
+func TestConfigureRateLimits(t *testing.T) {
+
+	rateLimiter := flowcontrol.NewFakeAlwaysRateLimiter()
+	c := &Client{}
+	for _, opt := range []Option{WithQPS(50), WithBurst(100), WithTimeout(time.Minute), WithRateLimiter(rateLimiter)} {
+		opt(c)
+	}
+
+	config := &rest.Config{}
+	c.configureRateLimits(config)
+
+	if config.QPS != 50 || config.Burst != 100 || config.Timeout != time.Minute || config.RateLimiter != rateLimiter {
+		t.Errorf("config = %+v, want the QPS, burst, timeout and rate limiter of the options", config)
+	}
+
+}
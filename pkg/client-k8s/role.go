@@ -2,17 +2,19 @@ package clientk8s
 
 import (
 	"context"
-	"log"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
 )
 
-// CreateRole ...
-func CreateRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
-
-	context := context.Background()
+// policyRulesFrom converts the rules into rbac/v1 policy rules.
+func policyRulesFrom(rules []Rbacv1PolicyRule) []rbacv1.PolicyRule {
 
 	var policyRules []rbacv1.PolicyRule
 
@@ -26,11 +28,18 @@ func CreateRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rb
 		})
 	}
 
-	roleSpec := &rbacv1.Role{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return policyRules
+
+}
+
+// GenerateRole returns the role CreateRole creates, without sending it to the
+// API server.
+func GenerateRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) *rbacv1.Role {
+
+	policyRules := policyRulesFrom(rules)
+
+	return &rbacv1.Role{
+		TypeMeta: typeMeta.withDefaults(KindRole, "rbac.authorization.k8s.io/v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -40,25 +49,36 @@ func CreateRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rb
 		Rules: policyRules,
 	}
 
-	_, err = k8sClientSet.RbacV1().Roles(objectMeta.Namespace).Create(context, roleSpec, metav1.CreateOptions{})
+}
 
-	if err != nil {
-		log.Printf("Error creating role: %v \n", err)
-		return err
-	}
+// CreateRole creates the role GenerateRole returns.
+func (c *Client) CreateRole(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
 
-	return nil
+	roleSpec := GenerateRole(typeMeta, objectMeta, rules)
+	c.labelOwner(roleSpec)
+
+	return c.do(ctx, OpCreate, KindRole, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().Roles(objectMeta.Namespace).Create(ctx, roleSpec, c.createOptions())
+		return err
+	})
 
 }
 
-func GetRole(name, namespace string) (*rbacv1.Role, error) {
+func (c *Client) GetRole(ctx context.Context, name, namespace string) (*rbacv1.Role, error) {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	result, err := k8sClientSet.RbacV1().Roles(namespace).Get(context, name, metav1.GetOptions{})
+	var result *rbacv1.Role
+
+	err := c.do(ctx, OpGet, KindRole, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().Roles(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting role: %v \n", err)
 		return nil, err
 	}
 
@@ -66,43 +86,35 @@ func GetRole(name, namespace string) (*rbacv1.Role, error) {
 
 }
 
-func UpdateRole(objRole *rbacv1.Role, rules []Rbacv1PolicyRule) error {
+func (c *Client) UpdateRole(ctx context.Context, objRole *rbacv1.Role, rules []Rbacv1PolicyRule) error {
 
-	context := context.Background()
+	objRole.Namespace = c.resolveNamespace(objRole.Namespace)
+	c.labelOwner(objRole)
 
-	var policyRules []rbacv1.PolicyRule
-
-	for _, item := range rules {
-		policyRules = append(policyRules, rbacv1.PolicyRule{
-			Verbs:           item.Verbs,
-			APIGroups:       item.APIGroups,
-			Resources:       item.Resources,
-			ResourceNames:   item.ResourceNames,
-			NonResourceURLs: item.NonResourceURLs,
-		})
-	}
+	policyRules := policyRulesFrom(rules)
 
 	objRole.Rules = policyRules
 
-	_, err := k8sClientSet.RbacV1().Roles(objRole.ObjectMeta.Namespace).Update(context, objRole, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating role: %v \n", err)
+	return c.do(ctx, OpUpdate, KindRole, objRole.Namespace, objRole.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().Roles(objRole.ObjectMeta.Namespace).Update(ctx, objRole, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListRole(namespace string) (*rbacv1.RoleList, error) {
+func (c *Client) ListRole(ctx context.Context, namespace string, listOptions ListOptions) (*rbacv1.RoleList, error) {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	result, err := k8sClientSet.RbacV1().Roles(namespace).List(context, metav1.ListOptions{})
+	var result *rbacv1.RoleList
+
+	err := c.do(ctx, OpList, KindRole, namespace, "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().Roles(listNamespace(namespace)).List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list roles: %v \n", err)
 		return nil, err
 	}
 
@@ -110,50 +122,282 @@ func ListRole(namespace string) (*rbacv1.RoleList, error) {
 
 }
 
-func DeleteRole(name, namespace string) error {
+// EachRole calls fn for every role matching listOptions, fetching them page by
+// page. It stops at the first error returned by fn.
+func (c *Client) EachRole(ctx context.Context, namespace string, listOptions ListOptions, fn func(*rbacv1.Role) error) error {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	deletePolicy := metav1.DeletePropagationForeground
+	return c.each(ctx, KindRole, namespace, listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.RbacV1().Roles(listNamespace(namespace)).List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*rbacv1.Role))
+	})
 
-	err := k8sClientSet.RbacV1().Roles(namespace).Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+}
+
+// RoleEvent is a change of a role reported by WatchRole.
+type RoleEvent struct {
+	Type EventType
+	Role *rbacv1.Role
+}
+
+// WatchRole calls fn for every change of the roles matching listOptions, until
+// ctx is cancelled or fn returns an error. It starts with an Added event per
+// existing role, unless listOptions.ResourceVersion is set, and resumes from
+// the last resourceVersion when the connection drops.
+func (c *Client) WatchRole(ctx context.Context, namespace string, listOptions ListOptions, fn func(RoleEvent) error) error {
+
+	namespace = c.resolveNamespace(namespace)
+
+	return c.watch(ctx, KindRole, namespace, listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.RbacV1().Roles(listNamespace(namespace)).List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.RbacV1().Roles(listNamespace(namespace)).Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(RoleEvent{Type: eventType, Role: obj.(*rbacv1.Role)})
 	})
 
-	if err != nil {
-		log.Printf("Error delete role: %v \n", err)
-		return err
-	}
+}
 
-	return nil
+func (c *Client) DeleteRole(ctx context.Context, name, namespace string) error {
+
+	namespace = c.resolveNamespace(namespace)
+
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindRole, namespace, name, func(ctx context.Context) error {
+		return c.clientset.RbacV1().Roles(namespace).Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdateRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetRole(objectMeta.Name, objectMeta.Namespace)
-		if getErr != nil {
-			log.Printf("Error getting role: %v \n", err)
-			// return err
+func (c *Client) CreateOrUpdateRole(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) (OperationResult, error) {
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindRole, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetRole(ctx, objectMeta.Name, objectMeta.Namespace)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
 
-		if resultGet != nil {
-			err := UpdateRole(resultGet, rules)
+		if getErr == nil {
+			if equality.Semantic.DeepEqual(resultGet.Rules, policyRulesFrom(rules)) && c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			err := c.UpdateRole(ctx, resultGet, rules)
 			if err != nil {
-				log.Printf("Error updating role: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
 		} else {
-			err := CreateRole(typeMeta, objectMeta, rules)
+			err := c.CreateRole(ctx, typeMeta, objectMeta, rules)
 			if err != nil {
-				log.Printf("Error creating role: %v \n", err)
 				return err
 			}
+			result = OperationResultCreated
 		}
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
+	}
+	return result, nil
+}
+
+// policyRuleApplyConfigurations converts the rules into their apply
+// configurations.
+func policyRuleApplyConfigurations(rules []Rbacv1PolicyRule) []*rbacv1ac.PolicyRuleApplyConfiguration {
+
+	var policyRules []*rbacv1ac.PolicyRuleApplyConfiguration
+
+	for _, item := range rules {
+		policyRules = append(policyRules, rbacv1ac.PolicyRule().
+			WithVerbs(item.Verbs...).
+			WithAPIGroups(item.APIGroups...).
+			WithResources(item.Resources...).
+			WithResourceNames(item.ResourceNames...).
+			WithNonResourceURLs(item.NonResourceURLs...))
+	}
+
+	return policyRules
+
+}
+
+// ApplyRole creates or updates the role using server-side apply, so only the
+// fields given here are owned by the field manager.
+func (c *Client) ApplyRole(ctx context.Context, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule, applyOptions ApplyOptions) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	roleApply := rbacv1ac.Role(objectMeta.Name, objectMeta.Namespace).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations).
+		WithRules(policyRuleApplyConfigurations(rules)...)
+
+	labels, annotations, err := c.driftStamps(roleApply)
+	if err != nil {
+		return newError(OpApply, KindRole, objectMeta.Namespace, objectMeta.Name, err)
 	}
-	return nil
+	roleApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindRole, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().Roles(objectMeta.Namespace).Apply(ctx, roleApply, c.applyOptions(applyOptions))
+		return applyError(KindRole, objectMeta.Namespace, objectMeta.Name, err)
+	})
+
+}
+
+// samePolicyRule reports whether both rules grant the same access.
+func samePolicyRule(a, b rbacv1.PolicyRule) bool {
+	return sameStrings(a.Verbs, b.Verbs) &&
+		sameStrings(a.APIGroups, b.APIGroups) &&
+		sameStrings(a.Resources, b.Resources) &&
+		sameStrings(a.ResourceNames, b.ResourceNames) &&
+		sameStrings(a.NonResourceURLs, b.NonResourceURLs)
+}
+
+// addPolicyRules appends the rules not already present in current.
+func addPolicyRules(current []rbacv1.PolicyRule, rules []Rbacv1PolicyRule) []rbacv1.PolicyRule {
+
+	result := append([]rbacv1.PolicyRule{}, current...)
+
+	for _, rule := range policyRulesFrom(rules) {
+		found := false
+		for _, item := range result {
+			if samePolicyRule(item, rule) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+
+}
+
+// removePolicyRules drops the given rules from current.
+func removePolicyRules(current []rbacv1.PolicyRule, rules []Rbacv1PolicyRule) []rbacv1.PolicyRule {
+
+	removed := policyRulesFrom(rules)
+	result := []rbacv1.PolicyRule{}
+
+	for _, item := range current {
+		found := false
+		for _, rule := range removed {
+			if samePolicyRule(item, rule) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, item)
+		}
+	}
+
+	return result
+
+}
+
+// AddRoleRules appends the rules not already granted by the role, keeping the
+// rules added by other writers.
+func (c *Client) AddRoleRules(ctx context.Context, name, namespace string, rules []Rbacv1PolicyRule) error {
+	return c.patchRoleRules(ctx, name, namespace, func(current []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+		return addPolicyRules(current, rules)
+	})
+}
+
+// RemoveRoleRules removes the given rules from the role.
+func (c *Client) RemoveRoleRules(ctx context.Context, name, namespace string, rules []Rbacv1PolicyRule) error {
+	return c.patchRoleRules(ctx, name, namespace, func(current []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+		return removePolicyRules(current, rules)
+	})
+}
+
+func (c *Client) patchRoleRules(ctx context.Context, name, namespace string, change func([]rbacv1.PolicyRule) []rbacv1.PolicyRule) error {
+	namespace = c.resolveNamespace(namespace)
+
+	return c.retryOnConflict(ctx, OpPatch, KindRole, namespace, name, func(ctx context.Context) error {
+		role, err := c.GetRole(ctx, name, namespace)
+		if err != nil {
+			return err
+		}
+
+		patch, err := mergePatchWithResourceVersion(role.ResourceVersion, map[string]interface{}{
+			"rules": change(role.Rules),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.Patch(ctx, KindRole, name, namespace, types.MergePatchType, patch)
+	})
+}
+
+// CreateRole calls Client.CreateRole on the default client.
+func CreateRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) error {
+	return defaultClient().CreateRole(context.Background(), typeMeta, objectMeta, rules)
+}
+
+// GetRole calls Client.GetRole on the default client.
+func GetRole(name, namespace string) (*rbacv1.Role, error) {
+	return defaultClient().GetRole(context.Background(), name, namespace)
+}
+
+// UpdateRole calls Client.UpdateRole on the default client.
+func UpdateRole(objRole *rbacv1.Role, rules []Rbacv1PolicyRule) error {
+	return defaultClient().UpdateRole(context.Background(), objRole, rules)
+}
+
+// ListRole calls Client.ListRole on the default client, without list options.
+func ListRole(namespace string) (*rbacv1.RoleList, error) {
+	return defaultClient().ListRole(context.Background(), namespace, ListOptions{})
+}
+
+// EachRole calls Client.EachRole on the default client.
+func EachRole(namespace string, listOptions ListOptions, fn func(*rbacv1.Role) error) error {
+	return defaultClient().EachRole(context.Background(), namespace, listOptions, fn)
+}
+
+// WatchRole calls Client.WatchRole on the default client.
+func WatchRole(namespace string, listOptions ListOptions, fn func(RoleEvent) error) error {
+	return defaultClient().WatchRole(context.Background(), namespace, listOptions, fn)
+}
+
+// DeleteRole calls Client.DeleteRole on the default client.
+func DeleteRole(name, namespace string) error {
+	return defaultClient().DeleteRole(context.Background(), name, namespace)
+}
+
+// CreateOrUpdateRole calls Client.CreateOrUpdateRole on the default client.
+func CreateOrUpdateRole(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule) (OperationResult, error) {
+	return defaultClient().CreateOrUpdateRole(context.Background(), typeMeta, objectMeta, rules)
+}
+
+// ApplyRole calls Client.ApplyRole on the default client.
+func ApplyRole(objectMeta Metav1ObjectMeta, rules []Rbacv1PolicyRule, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyRole(context.Background(), objectMeta, rules, applyOptions)
+}
+
+// AddRoleRules calls Client.AddRoleRules on the default client.
+func AddRoleRules(name, namespace string, rules []Rbacv1PolicyRule) error {
+	return defaultClient().AddRoleRules(context.Background(), name, namespace, rules)
+}
+
+// RemoveRoleRules calls Client.RemoveRoleRules on the default client.
+func RemoveRoleRules(name, namespace string, rules []Rbacv1PolicyRule) error {
+	return defaultClient().RemoveRoleRules(context.Background(), name, namespace, rules)
 }
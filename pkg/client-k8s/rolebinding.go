@@ -2,17 +2,19 @@ package clientk8s
 
 import (
 	"context"
-	"log"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
 )
 
-// CreateRoleBinding ...
-func CreateRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
-
-	context := context.Background()
+// subjectsFrom converts the subjects into rbac/v1 subjects.
+func subjectsFrom(subject []Rbacv1Subject) []rbacv1.Subject {
 
 	var subjectItems []rbacv1.Subject
 
@@ -25,11 +27,18 @@ func CreateRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, sub
 		})
 	}
 
-	roleBindingSpec := &rbacv1.RoleBinding{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return subjectItems
+
+}
+
+// GenerateRoleBinding returns the role binding CreateRoleBinding creates,
+// without sending it to the API server.
+func GenerateRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) *rbacv1.RoleBinding {
+
+	subjectItems := subjectsFrom(subject)
+
+	return &rbacv1.RoleBinding{
+		TypeMeta: typeMeta.withDefaults(KindRoleBinding, "rbac.authorization.k8s.io/v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -44,25 +53,36 @@ func CreateRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, sub
 		},
 	}
 
-	_, err = k8sClientSet.RbacV1().RoleBindings(objectMeta.Namespace).Create(context, roleBindingSpec, metav1.CreateOptions{})
+}
 
-	if err != nil {
-		log.Printf("Error creating role binding: %v \n", err)
-		return err
-	}
+// CreateRoleBinding creates the role binding GenerateRoleBinding returns.
+func (c *Client) CreateRoleBinding(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
 
-	return nil
+	roleBindingSpec := GenerateRoleBinding(typeMeta, objectMeta, subject, roleRef)
+	c.labelOwner(roleBindingSpec)
+
+	return c.do(ctx, OpCreate, KindRoleBinding, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().RoleBindings(objectMeta.Namespace).Create(ctx, roleBindingSpec, c.createOptions())
+		return err
+	})
 
 }
 
-func GetRoleBinding(name, namespace string) (*rbacv1.RoleBinding, error) {
+func (c *Client) GetRoleBinding(ctx context.Context, name, namespace string) (*rbacv1.RoleBinding, error) {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	result, err := k8sClientSet.RbacV1().RoleBindings(namespace).Get(context, name, metav1.GetOptions{})
+	var result *rbacv1.RoleBinding
+
+	err := c.do(ctx, OpGet, KindRoleBinding, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().RoleBindings(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting role binding: %v \n", err)
 		return nil, err
 	}
 
@@ -70,42 +90,35 @@ func GetRoleBinding(name, namespace string) (*rbacv1.RoleBinding, error) {
 
 }
 
-func UpdateRoleBinding(objRoleBinding *rbacv1.RoleBinding, subject []Rbacv1Subject) error {
+func (c *Client) UpdateRoleBinding(ctx context.Context, objRoleBinding *rbacv1.RoleBinding, subject []Rbacv1Subject) error {
 
-	context := context.Background()
+	objRoleBinding.Namespace = c.resolveNamespace(objRoleBinding.Namespace)
+	c.labelOwner(objRoleBinding)
 
-	var subjectItems []rbacv1.Subject
-
-	for _, item := range subject {
-		subjectItems = append(subjectItems, rbacv1.Subject{
-			Kind:      item.Kind,
-			APIGroup:  item.APIGroup,
-			Name:      item.Name,
-			Namespace: item.Namespace,
-		})
-	}
+	subjectItems := subjectsFrom(subject)
 
 	objRoleBinding.Subjects = subjectItems
 
-	_, err := k8sClientSet.RbacV1().RoleBindings(objRoleBinding.ObjectMeta.Namespace).Update(context, objRoleBinding, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating role binding: %v \n", err)
+	return c.do(ctx, OpUpdate, KindRoleBinding, objRoleBinding.Namespace, objRoleBinding.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().RoleBindings(objRoleBinding.ObjectMeta.Namespace).Update(ctx, objRoleBinding, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListRoleBinding(namespace string) (*rbacv1.RoleBindingList, error) {
+func (c *Client) ListRoleBinding(ctx context.Context, namespace string, listOptions ListOptions) (*rbacv1.RoleBindingList, error) {
+
+	namespace = c.resolveNamespace(namespace)
 
-	context := context.Background()
+	var result *rbacv1.RoleBindingList
 
-	result, err := k8sClientSet.RbacV1().RoleBindings(namespace).List(context, metav1.ListOptions{})
+	err := c.do(ctx, OpList, KindRoleBinding, namespace, "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.RbacV1().RoleBindings(listNamespace(namespace)).List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list role bindings: %v \n", err)
 		return nil, err
 	}
 
@@ -113,50 +126,291 @@ func ListRoleBinding(namespace string) (*rbacv1.RoleBindingList, error) {
 
 }
 
-func DeleteRoleBinding(name, namespace string) error {
+// EachRoleBinding calls fn for every role binding matching listOptions,
+// fetching them page by page. It stops at the first error returned by fn.
+func (c *Client) EachRoleBinding(ctx context.Context, namespace string, listOptions ListOptions, fn func(*rbacv1.RoleBinding) error) error {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	deletePolicy := metav1.DeletePropagationForeground
+	return c.each(ctx, KindRoleBinding, namespace, listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.RbacV1().RoleBindings(listNamespace(namespace)).List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*rbacv1.RoleBinding))
+	})
+
+}
+
+// RoleBindingEvent is a change of a role binding reported by WatchRoleBinding.
+type RoleBindingEvent struct {
+	Type        EventType
+	RoleBinding *rbacv1.RoleBinding
+}
+
+// WatchRoleBinding calls fn for every change of the role bindings matching
+// listOptions, until ctx is cancelled or fn returns an error. It starts with
+// an Added event per existing role binding, unless listOptions.ResourceVersion
+// is set, and resumes from the last resourceVersion when the connection drops.
+func (c *Client) WatchRoleBinding(ctx context.Context, namespace string, listOptions ListOptions, fn func(RoleBindingEvent) error) error {
 
-	err := k8sClientSet.RbacV1().RoleBindings(namespace).Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+	namespace = c.resolveNamespace(namespace)
+
+	return c.watch(ctx, KindRoleBinding, namespace, listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.RbacV1().RoleBindings(listNamespace(namespace)).List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.RbacV1().RoleBindings(listNamespace(namespace)).Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(RoleBindingEvent{Type: eventType, RoleBinding: obj.(*rbacv1.RoleBinding)})
 	})
 
-	if err != nil {
-		log.Printf("Error delete role binding: %v \n", err)
-		return err
-	}
+}
+
+func (c *Client) DeleteRoleBinding(ctx context.Context, name, namespace string) error {
+
+	namespace = c.resolveNamespace(namespace)
 
-	return nil
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindRoleBinding, namespace, name, func(ctx context.Context) error {
+		return c.clientset.RbacV1().RoleBindings(namespace).Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdateRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetRoleBinding(objectMeta.Name, objectMeta.Namespace)
-		if getErr != nil {
-			log.Printf("Error getting role binding: %v \n", err)
-			// return err
+func (c *Client) CreateOrUpdateRoleBinding(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) (OperationResult, error) {
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindRoleBinding, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetRoleBinding(ctx, objectMeta.Name, objectMeta.Namespace)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
 
-		if resultGet != nil {
-			err := UpdateRoleBinding(resultGet, subject)
+		if getErr == nil {
+			if equality.Semantic.DeepEqual(resultGet.Subjects, subjectsFrom(subject)) && c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			err := c.UpdateRoleBinding(ctx, resultGet, subject)
 			if err != nil {
-				log.Printf("Error updating role binding: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
 		} else {
-			err := CreateRoleBinding(typeMeta, objectMeta, subject, roleRef)
+			err := c.CreateRoleBinding(ctx, typeMeta, objectMeta, subject, roleRef)
 			if err != nil {
-				log.Printf("Error creating role binding: %v \n", err)
 				return err
 			}
+			result = OperationResultCreated
 		}
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
 	}
-	return nil
+	return result, nil
+}
+
+// subjectApplyConfigurations converts the subjects into their apply
+// configurations.
+func subjectApplyConfigurations(subject []Rbacv1Subject) []*rbacv1ac.SubjectApplyConfiguration {
+
+	var subjectItems []*rbacv1ac.SubjectApplyConfiguration
+
+	for _, item := range subject {
+		subjectItem := rbacv1ac.Subject().
+			WithKind(item.Kind).
+			WithName(item.Name)
+		if item.APIGroup != "" {
+			subjectItem = subjectItem.WithAPIGroup(item.APIGroup)
+		}
+		if item.Namespace != "" {
+			subjectItem = subjectItem.WithNamespace(item.Namespace)
+		}
+		subjectItems = append(subjectItems, subjectItem)
+	}
+
+	return subjectItems
+
+}
+
+// roleRefApplyConfiguration converts the role reference into its apply
+// configuration.
+func roleRefApplyConfiguration(roleRef Rbacv1RoleRef) *rbacv1ac.RoleRefApplyConfiguration {
+
+	return rbacv1ac.RoleRef().
+		WithAPIGroup(roleRef.APIGroup).
+		WithKind(roleRef.Kind).
+		WithName(roleRef.Name)
+
+}
+
+// ApplyRoleBinding creates or updates the role binding using server-side
+// apply, so only the fields given here are owned by the field manager.
+func (c *Client) ApplyRoleBinding(ctx context.Context, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef, applyOptions ApplyOptions) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	roleBindingApply := rbacv1ac.RoleBinding(objectMeta.Name, objectMeta.Namespace).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations).
+		WithSubjects(subjectApplyConfigurations(subject)...).
+		WithRoleRef(roleRefApplyConfiguration(roleRef))
+
+	labels, annotations, err := c.driftStamps(roleBindingApply)
+	if err != nil {
+		return newError(OpApply, KindRoleBinding, objectMeta.Namespace, objectMeta.Name, err)
+	}
+	roleBindingApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindRoleBinding, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.RbacV1().RoleBindings(objectMeta.Namespace).Apply(ctx, roleBindingApply, c.applyOptions(applyOptions))
+		return applyError(KindRoleBinding, objectMeta.Namespace, objectMeta.Name, err)
+	})
+
+}
+
+// addSubjects appends the subjects not already present in current.
+func addSubjects(current []rbacv1.Subject, subject []Rbacv1Subject) []rbacv1.Subject {
+
+	result := append([]rbacv1.Subject{}, current...)
+
+	for _, item := range subjectsFrom(subject) {
+		found := false
+		for _, existing := range result {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, item)
+		}
+	}
+
+	return result
+
+}
+
+// removeSubjects drops the given subjects from current.
+func removeSubjects(current []rbacv1.Subject, subject []Rbacv1Subject) []rbacv1.Subject {
+
+	removed := subjectsFrom(subject)
+	result := []rbacv1.Subject{}
+
+	for _, existing := range current {
+		found := false
+		for _, item := range removed {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, existing)
+		}
+	}
+
+	return result
+
+}
+
+// AddSubjectsToRoleBinding appends the subjects not already bound, keeping
+// the subjects added by other writers.
+func (c *Client) AddSubjectsToRoleBinding(ctx context.Context, name, namespace string, subject []Rbacv1Subject) error {
+	return c.patchRoleBindingSubjects(ctx, name, namespace, func(current []rbacv1.Subject) []rbacv1.Subject {
+		return addSubjects(current, subject)
+	})
+}
+
+// RemoveSubjectsFromRoleBinding removes the given subjects from the role
+// binding.
+func (c *Client) RemoveSubjectsFromRoleBinding(ctx context.Context, name, namespace string, subject []Rbacv1Subject) error {
+	return c.patchRoleBindingSubjects(ctx, name, namespace, func(current []rbacv1.Subject) []rbacv1.Subject {
+		return removeSubjects(current, subject)
+	})
+}
+
+func (c *Client) patchRoleBindingSubjects(ctx context.Context, name, namespace string, change func([]rbacv1.Subject) []rbacv1.Subject) error {
+	namespace = c.resolveNamespace(namespace)
+
+	return c.retryOnConflict(ctx, OpPatch, KindRoleBinding, namespace, name, func(ctx context.Context) error {
+		roleBinding, err := c.GetRoleBinding(ctx, name, namespace)
+		if err != nil {
+			return err
+		}
+
+		patch, err := mergePatchWithResourceVersion(roleBinding.ResourceVersion, map[string]interface{}{
+			"subjects": change(roleBinding.Subjects),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.Patch(ctx, KindRoleBinding, name, namespace, types.MergePatchType, patch)
+	})
+}
+
+// CreateRoleBinding calls Client.CreateRoleBinding on the default client.
+func CreateRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) error {
+	return defaultClient().CreateRoleBinding(context.Background(), typeMeta, objectMeta, subject, roleRef)
+}
+
+// GetRoleBinding calls Client.GetRoleBinding on the default client.
+func GetRoleBinding(name, namespace string) (*rbacv1.RoleBinding, error) {
+	return defaultClient().GetRoleBinding(context.Background(), name, namespace)
+}
+
+// UpdateRoleBinding calls Client.UpdateRoleBinding on the default client.
+func UpdateRoleBinding(objRoleBinding *rbacv1.RoleBinding, subject []Rbacv1Subject) error {
+	return defaultClient().UpdateRoleBinding(context.Background(), objRoleBinding, subject)
+}
+
+// ListRoleBinding calls Client.ListRoleBinding on the default client, without
+// list options.
+func ListRoleBinding(namespace string) (*rbacv1.RoleBindingList, error) {
+	return defaultClient().ListRoleBinding(context.Background(), namespace, ListOptions{})
+}
+
+// EachRoleBinding calls Client.EachRoleBinding on the default client.
+func EachRoleBinding(namespace string, listOptions ListOptions, fn func(*rbacv1.RoleBinding) error) error {
+	return defaultClient().EachRoleBinding(context.Background(), namespace, listOptions, fn)
+}
+
+// WatchRoleBinding calls Client.WatchRoleBinding on the default client.
+func WatchRoleBinding(namespace string, listOptions ListOptions, fn func(RoleBindingEvent) error) error {
+	return defaultClient().WatchRoleBinding(context.Background(), namespace, listOptions, fn)
+}
+
+// DeleteRoleBinding calls Client.DeleteRoleBinding on the default client.
+func DeleteRoleBinding(name, namespace string) error {
+	return defaultClient().DeleteRoleBinding(context.Background(), name, namespace)
+}
+
+// CreateOrUpdateRoleBinding calls Client.CreateOrUpdateRoleBinding on the default client.
+func CreateOrUpdateRoleBinding(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef) (OperationResult, error) {
+	return defaultClient().CreateOrUpdateRoleBinding(context.Background(), typeMeta, objectMeta, subject, roleRef)
+}
+
+// ApplyRoleBinding calls Client.ApplyRoleBinding on the default client.
+func ApplyRoleBinding(objectMeta Metav1ObjectMeta, subject []Rbacv1Subject, roleRef Rbacv1RoleRef, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyRoleBinding(context.Background(), objectMeta, subject, roleRef, applyOptions)
+}
+
+// AddSubjectsToRoleBinding calls Client.AddSubjectsToRoleBinding on the default client.
+func AddSubjectsToRoleBinding(name, namespace string, subject []Rbacv1Subject) error {
+	return defaultClient().AddSubjectsToRoleBinding(context.Background(), name, namespace, subject)
+}
+
+// RemoveSubjectsFromRoleBinding calls Client.RemoveSubjectsFromRoleBinding on the default client.
+func RemoveSubjectsFromRoleBinding(name, namespace string, subject []Rbacv1Subject) error {
+	return defaultClient().RemoveSubjectsFromRoleBinding(context.Background(), name, namespace, subject)
 }
@@ -2,18 +2,21 @@ package clientk8s
 
 import (
 	"context"
-	"log"
+	"encoding/json"
 
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 )
 
-// CreateSecret ...
-func CreateSecret(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) error {
-
-	context := context.Background()
+// secretType maps the SecretTypeStruct names to the core/v1 secret types.
+func secretType(typeSecret SecretTypeStruct) corev1.SecretType {
 
 	var typeSecretSelected corev1.SecretType
 
@@ -36,11 +39,18 @@ func CreateSecret(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecr
 		typeSecretSelected = corev1.SecretTypeTLS
 	}
 
-	secret := corev1.Secret{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return typeSecretSelected
+
+}
+
+// GenerateSecret returns the secret CreateSecret creates, without sending it
+// to the API server.
+func GenerateSecret(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) *corev1.Secret {
+
+	typeSecretSelected := secretType(typeSecret)
+
+	return &corev1.Secret{
+		TypeMeta: typeMeta.withDefaults(KindSecret, "v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -52,25 +62,36 @@ func CreateSecret(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecr
 		StringData: stringData,
 	}
 
-	_, err = k8sClientSet.CoreV1().Secrets(objectMeta.Namespace).Create(context, &secret, metav1.CreateOptions{})
+}
+
+// CreateSecret creates the secret GenerateSecret returns.
+func (c *Client) CreateSecret(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) error {
 
-	if err != nil {
-		log.Printf("Failed to create the secret: %v \n", err)
-		return err
-	}
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
 
-	return nil
+	secret := GenerateSecret(typeMeta, objectMeta, typeSecret, data, stringData)
+	c.labelOwner(secret)
+
+	return c.do(ctx, OpCreate, KindSecret, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().Secrets(objectMeta.Namespace).Create(ctx, secret, c.createOptions())
+		return err
+	})
 
 }
 
-func GetSecret(name, namespace string) (*v1.Secret, error) {
+func (c *Client) GetSecret(ctx context.Context, name, namespace string) (*v1.Secret, error) {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	result, err := k8sClientSet.CoreV1().Secrets(namespace).Get(context, name, metav1.GetOptions{})
+	var result *v1.Secret
+
+	err := c.do(ctx, OpGet, KindSecret, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting Secret: %v \n", err)
 		return nil, err
 	}
 
@@ -78,54 +99,37 @@ func GetSecret(name, namespace string) (*v1.Secret, error) {
 
 }
 
-func UpdateSecret(objSecret *v1.Secret, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) error {
+func (c *Client) UpdateSecret(ctx context.Context, objSecret *v1.Secret, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) error {
 
-	context := context.Background()
-
-	var typeSecretSelected corev1.SecretType
+	objSecret.Namespace = c.resolveNamespace(objSecret.Namespace)
+	c.labelOwner(objSecret)
 
-	switch typeSecret.SecretType {
-	case "SecretTypeBasicAuth":
-		typeSecretSelected = corev1.SecretTypeBasicAuth
-	case "SecretTypeBootstrapToken":
-		typeSecretSelected = corev1.SecretTypeBootstrapToken
-	case "SecretTypeDockerConfigJson":
-		typeSecretSelected = corev1.SecretTypeDockerConfigJson
-	case "SecretTypeDockercfg":
-		typeSecretSelected = corev1.SecretTypeDockercfg
-	case "SecretTypeOpaque":
-		typeSecretSelected = corev1.SecretTypeOpaque
-	case "SecretTypeSSHAuth":
-		typeSecretSelected = corev1.SecretTypeSSHAuth
-	case "SecretTypeServiceAccountToken":
-		typeSecretSelected = corev1.SecretTypeServiceAccountToken
-	case "SecretTypeTLS":
-		typeSecretSelected = corev1.SecretTypeTLS
-	}
+	typeSecretSelected := secretType(typeSecret)
 
 	objSecret.Type = typeSecretSelected
 	objSecret.Data = data
 	objSecret.StringData = stringData
 
-	_, err := k8sClientSet.CoreV1().Secrets(objSecret.ObjectMeta.Namespace).Update(context, objSecret, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating Secret: %v \n", err)
+	return c.do(ctx, OpUpdate, KindSecret, objSecret.Namespace, objSecret.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().Secrets(objSecret.ObjectMeta.Namespace).Update(ctx, objSecret, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListSecret(namespace string) (*v1.SecretList, error) {
+func (c *Client) ListSecret(ctx context.Context, namespace string, listOptions ListOptions) (*v1.SecretList, error) {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	result, err := k8sClientSet.CoreV1().Secrets(namespace).List(context, metav1.ListOptions{})
+	var result *v1.SecretList
+
+	err := c.do(ctx, OpList, KindSecret, namespace, "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().Secrets(listNamespace(namespace)).List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list Secrets: %v \n", err)
 		return nil, err
 	}
 
@@ -133,50 +137,232 @@ func ListSecret(namespace string) (*v1.SecretList, error) {
 
 }
 
-func DeleteSecret(name, namespace string) error {
+// EachSecret calls fn for every secret matching listOptions, fetching them
+// page by page. It stops at the first error returned by fn.
+func (c *Client) EachSecret(ctx context.Context, namespace string, listOptions ListOptions, fn func(*v1.Secret) error) error {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	deletePolicy := metav1.DeletePropagationForeground
+	return c.each(ctx, KindSecret, namespace, listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.CoreV1().Secrets(listNamespace(namespace)).List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*v1.Secret))
+	})
 
-	err := k8sClientSet.CoreV1().Secrets(namespace).Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+}
+
+// SecretEvent is a change of a secret reported by WatchSecret.
+type SecretEvent struct {
+	Type   EventType
+	Secret *v1.Secret
+}
+
+// WatchSecret calls fn for every change of the secrets matching listOptions,
+// until ctx is cancelled or fn returns an error. It starts with an Added event
+// per existing secret, unless listOptions.ResourceVersion is set, and resumes
+// from the last resourceVersion when the connection drops.
+func (c *Client) WatchSecret(ctx context.Context, namespace string, listOptions ListOptions, fn func(SecretEvent) error) error {
+
+	namespace = c.resolveNamespace(namespace)
+
+	return c.watch(ctx, KindSecret, namespace, listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.CoreV1().Secrets(listNamespace(namespace)).List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.CoreV1().Secrets(listNamespace(namespace)).Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(SecretEvent{Type: eventType, Secret: obj.(*v1.Secret)})
 	})
 
-	if err != nil {
-		log.Printf("Error delete Secret: %v \n", err)
-		return err
-	}
+}
+
+func (c *Client) DeleteSecret(ctx context.Context, name, namespace string) error {
 
-	return nil
+	namespace = c.resolveNamespace(namespace)
+
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindSecret, namespace, name, func(ctx context.Context) error {
+		return c.clientset.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdateSecret(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetSecret(objectMeta.Name, objectMeta.Namespace)
-		if getErr != nil {
-			log.Printf("Error getting Secret: %v \n", err)
-			// return err
+func (c *Client) CreateOrUpdateSecret(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) (OperationResult, error) {
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindSecret, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetSecret(ctx, objectMeta.Name, objectMeta.Namespace)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
 
-		if resultGet != nil {
-			err := UpdateSecret(resultGet, typeSecret, data, stringData)
+		if getErr == nil {
+			if secretUnchanged(resultGet, typeSecret, data, stringData) && c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			err := c.UpdateSecret(ctx, resultGet, typeSecret, data, stringData)
 			if err != nil {
-				log.Printf("Error updating Secret: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
 		} else {
-			err := CreateSecret(typeMeta, objectMeta, typeSecret, data, stringData)
+			err := c.CreateSecret(ctx, typeMeta, objectMeta, typeSecret, data, stringData)
 			if err != nil {
-				log.Printf("Error creating Secret: %v \n", err)
 				return err
 			}
+			result = OperationResultCreated
 		}
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
+	}
+	return result, nil
+}
+
+// ApplySecret creates or updates the secret using server-side apply, so only
+// the fields given here are owned by the field manager.
+func (c *Client) ApplySecret(ctx context.Context, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string, applyOptions ApplyOptions) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	secretApply := corev1ac.Secret(objectMeta.Name, objectMeta.Namespace).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations).
+		WithData(data).
+		WithStringData(stringData)
+
+	if typeSecretSelected := secretType(typeSecret); typeSecretSelected != "" {
+		secretApply = secretApply.WithType(typeSecretSelected)
+	}
+
+	labels, annotations, err := c.driftStamps(secretApply)
+	if err != nil {
+		return newError(OpApply, KindSecret, objectMeta.Namespace, objectMeta.Name, err)
+	}
+	secretApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindSecret, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().Secrets(objectMeta.Namespace).Apply(ctx, secretApply, c.applyOptions(applyOptions))
+		return applyError(KindSecret, objectMeta.Namespace, objectMeta.Name, err)
+	})
+
+}
+
+// PatchSecretKeys adds or overwrites the given keys with a strategic merge
+// patch, leaving the other keys as they are.
+func (c *Client) PatchSecretKeys(ctx context.Context, name, namespace string, data map[string][]byte) error {
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, KindSecret, name, namespace, types.StrategicMergePatchType, patch)
+
+}
+
+// RemoveSecretKeys removes the given keys with a JSON merge patch. Missing
+// keys are ignored.
+func (c *Client) RemoveSecretKeys(ctx context.Context, name, namespace string, keys []string) error {
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": nullValues(keys),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, KindSecret, name, namespace, types.MergePatchType, patch)
+
+}
+
+// secretUnchanged reports whether the secret already holds the desired type
+// and data. The stringData keys are compared against data, as the API server
+// merges them into it.
+func secretUnchanged(objSecret *v1.Secret, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) bool {
+
+	typeSecretSelected := secretType(typeSecret)
+	if typeSecretSelected != "" && objSecret.Type != typeSecretSelected {
+		return false
+	}
+
+	desiredData := make(map[string][]byte, len(data)+len(stringData))
+	for key, value := range data {
+		desiredData[key] = value
 	}
-	return nil
+	for key, value := range stringData {
+		desiredData[key] = []byte(value)
+	}
+
+	return equality.Semantic.DeepEqual(objSecret.Data, desiredData)
+
+}
+
+// CreateSecret calls Client.CreateSecret on the default client.
+func CreateSecret(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) error {
+	return defaultClient().CreateSecret(context.Background(), typeMeta, objectMeta, typeSecret, data, stringData)
+}
+
+// GetSecret calls Client.GetSecret on the default client.
+func GetSecret(name, namespace string) (*v1.Secret, error) {
+	return defaultClient().GetSecret(context.Background(), name, namespace)
+}
+
+// UpdateSecret calls Client.UpdateSecret on the default client.
+func UpdateSecret(objSecret *v1.Secret, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) error {
+	return defaultClient().UpdateSecret(context.Background(), objSecret, typeSecret, data, stringData)
+}
+
+// ListSecret calls Client.ListSecret on the default client, without list
+// options.
+func ListSecret(namespace string) (*v1.SecretList, error) {
+	return defaultClient().ListSecret(context.Background(), namespace, ListOptions{})
+}
+
+// EachSecret calls Client.EachSecret on the default client.
+func EachSecret(namespace string, listOptions ListOptions, fn func(*v1.Secret) error) error {
+	return defaultClient().EachSecret(context.Background(), namespace, listOptions, fn)
+}
+
+// WatchSecret calls Client.WatchSecret on the default client.
+func WatchSecret(namespace string, listOptions ListOptions, fn func(SecretEvent) error) error {
+	return defaultClient().WatchSecret(context.Background(), namespace, listOptions, fn)
+}
+
+// DeleteSecret calls Client.DeleteSecret on the default client.
+func DeleteSecret(name, namespace string) error {
+	return defaultClient().DeleteSecret(context.Background(), name, namespace)
+}
+
+// CreateOrUpdateSecret calls Client.CreateOrUpdateSecret on the default client.
+func CreateOrUpdateSecret(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string) (OperationResult, error) {
+	return defaultClient().CreateOrUpdateSecret(context.Background(), typeMeta, objectMeta, typeSecret, data, stringData)
+}
+
+// ApplySecret calls Client.ApplySecret on the default client.
+func ApplySecret(objectMeta Metav1ObjectMeta, typeSecret SecretTypeStruct, data map[string][]byte, stringData map[string]string, applyOptions ApplyOptions) error {
+	return defaultClient().ApplySecret(context.Background(), objectMeta, typeSecret, data, stringData, applyOptions)
+}
+
+// PatchSecretKeys calls Client.PatchSecretKeys on the default client.
+func PatchSecretKeys(name, namespace string, data map[string][]byte) error {
+	return defaultClient().PatchSecretKeys(context.Background(), name, namespace, data)
+}
+
+// RemoveSecretKeys calls Client.RemoveSecretKeys on the default client.
+func RemoveSecretKeys(name, namespace string, keys []string) error {
+	return defaultClient().RemoveSecretKeys(context.Background(), name, namespace, keys)
 }
@@ -2,17 +2,20 @@ package clientk8s
 
 import (
 	"context"
-	"log"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 )
 
 // CreateServiceAccount
-func CreateServiceAccount(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string) error {
-
-	context := context.Background()
+// GenerateServiceAccount returns the service account CreateServiceAccount
+// creates, without sending it to the API server.
+func GenerateServiceAccount(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string) *v1.ServiceAccount {
 
 	secretReferences := []v1.ObjectReference{}
 
@@ -23,11 +26,8 @@ func CreateServiceAccount(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta,
 		})
 	}
 
-	specServiceAccount := &v1.ServiceAccount{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       typeMeta.Kind,
-			APIVersion: typeMeta.APIVersion,
-		},
+	return &v1.ServiceAccount{
+		TypeMeta: typeMeta.withDefaults(KindServiceAccount, "v1"),
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        objectMeta.Name,
 			Namespace:   objectMeta.Namespace,
@@ -42,25 +42,35 @@ func CreateServiceAccount(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta,
 		Secrets: secretReferences,
 	}
 
-	_, err = k8sClientSet.CoreV1().ServiceAccounts(objectMeta.Namespace).Create(context, specServiceAccount, metav1.CreateOptions{})
+}
 
-	if err != nil {
-		log.Printf("Failed to create the service account: %v \n", err)
-		return err
-	}
+func (c *Client) CreateServiceAccount(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string) error {
 
-	return nil
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	specServiceAccount := GenerateServiceAccount(typeMeta, objectMeta, secretsArrStr, imageSecret)
+	c.labelOwner(specServiceAccount)
+
+	return c.do(ctx, OpCreate, KindServiceAccount, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().ServiceAccounts(objectMeta.Namespace).Create(ctx, specServiceAccount, c.createOptions())
+		return err
+	})
 
 }
 
-func GetServiceAccount(name, namespace string) (*v1.ServiceAccount, error) {
+func (c *Client) GetServiceAccount(ctx context.Context, name, namespace string) (*v1.ServiceAccount, error) {
+
+	namespace = c.resolveNamespace(namespace)
 
-	context := context.Background()
+	var result *v1.ServiceAccount
 
-	result, err := k8sClientSet.CoreV1().ServiceAccounts(namespace).Get(context, name, metav1.GetOptions{})
+	err := c.do(ctx, OpGet, KindServiceAccount, namespace, name, func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error getting ServiceAccount: %v \n", err)
 		return nil, err
 	}
 
@@ -68,9 +78,10 @@ func GetServiceAccount(name, namespace string) (*v1.ServiceAccount, error) {
 
 }
 
-func UpdateServiceAccount(objServiceAccount *v1.ServiceAccount, secretsArrStr []string, imageSecret string) error {
+func (c *Client) UpdateServiceAccount(ctx context.Context, objServiceAccount *v1.ServiceAccount, secretsArrStr []string, imageSecret string) error {
 
-	context := context.Background()
+	objServiceAccount.Namespace = c.resolveNamespace(objServiceAccount.Namespace)
+	c.labelOwner(objServiceAccount)
 
 	secretReferences := []v1.ObjectReference{}
 
@@ -88,25 +99,26 @@ func UpdateServiceAccount(objServiceAccount *v1.ServiceAccount, secretsArrStr []
 	}
 	objServiceAccount.Secrets = secretReferences
 
-	_, err := k8sClientSet.CoreV1().ServiceAccounts(objServiceAccount.ObjectMeta.Namespace).Update(context, objServiceAccount, metav1.UpdateOptions{})
-
-	if err != nil {
-		log.Printf("Error updating ServiceAccount: %v \n", err)
+	return c.do(ctx, OpUpdate, KindServiceAccount, objServiceAccount.Namespace, objServiceAccount.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().ServiceAccounts(objServiceAccount.ObjectMeta.Namespace).Update(ctx, objServiceAccount, c.updateOptions())
 		return err
-	}
-
-	return nil
+	})
 
 }
 
-func ListServiceAccount(namespace string) (*v1.ServiceAccountList, error) {
+func (c *Client) ListServiceAccount(ctx context.Context, namespace string, listOptions ListOptions) (*v1.ServiceAccountList, error) {
+
+	namespace = c.resolveNamespace(namespace)
 
-	context := context.Background()
+	var result *v1.ServiceAccountList
 
-	result, err := k8sClientSet.CoreV1().ServiceAccounts(namespace).List(context, metav1.ListOptions{})
+	err := c.do(ctx, OpList, KindServiceAccount, namespace, "", func(ctx context.Context) error {
+		var err error
+		result, err = c.clientset.CoreV1().ServiceAccounts(listNamespace(namespace)).List(ctx, listOptions.metav1())
+		return err
+	})
 
 	if err != nil {
-		log.Printf("Error list ServiceAccounts: %v \n", err)
 		return nil, err
 	}
 
@@ -114,50 +126,197 @@ func ListServiceAccount(namespace string) (*v1.ServiceAccountList, error) {
 
 }
 
-func DeleteServiceAccount(name, namespace string) error {
+// EachServiceAccount calls fn for every service account matching listOptions,
+// fetching them page by page. It stops at the first error returned by fn.
+func (c *Client) EachServiceAccount(ctx context.Context, namespace string, listOptions ListOptions, fn func(*v1.ServiceAccount) error) error {
 
-	context := context.Background()
+	namespace = c.resolveNamespace(namespace)
 
-	deletePolicy := metav1.DeletePropagationForeground
+	return c.each(ctx, KindServiceAccount, namespace, listOptions, func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.CoreV1().ServiceAccounts(listNamespace(namespace)).List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		return fn(obj.(*v1.ServiceAccount))
+	})
+
+}
+
+// ServiceAccountEvent is a change of a service account reported by
+// WatchServiceAccount.
+type ServiceAccountEvent struct {
+	Type           EventType
+	ServiceAccount *v1.ServiceAccount
+}
+
+// WatchServiceAccount calls fn for every change of the service accounts
+// matching listOptions, until ctx is cancelled or fn returns an error. It
+// starts with an Added event per existing service account, unless
+// listOptions.ResourceVersion is set, and resumes from the last
+// resourceVersion when the connection drops.
+func (c *Client) WatchServiceAccount(ctx context.Context, namespace string, listOptions ListOptions, fn func(ServiceAccountEvent) error) error {
 
-	err := k8sClientSet.CoreV1().ServiceAccounts(namespace).Delete(context, name, metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
+	namespace = c.resolveNamespace(namespace)
+
+	return c.watch(ctx, KindServiceAccount, namespace, listOptions, watchFuncs{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.clientset.CoreV1().ServiceAccounts(listNamespace(namespace)).List(ctx, opts)
+		},
+		watch: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return c.clientset.CoreV1().ServiceAccounts(listNamespace(namespace)).Watch(ctx, opts)
+		},
+	}, func(eventType EventType, obj runtime.Object) error {
+		return fn(ServiceAccountEvent{Type: eventType, ServiceAccount: obj.(*v1.ServiceAccount)})
 	})
 
-	if err != nil {
-		log.Printf("Error delete ServiceAccount: %v \n", err)
-		return err
-	}
+}
+
+func (c *Client) DeleteServiceAccount(ctx context.Context, name, namespace string) error {
 
-	return nil
+	namespace = c.resolveNamespace(namespace)
+
+	deletePolicy := metav1.DeletePropagationForeground
+
+	return c.do(ctx, OpDelete, KindServiceAccount, namespace, name, func(ctx context.Context) error {
+		return c.clientset.CoreV1().ServiceAccounts(namespace).Delete(ctx, name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			DryRun:            c.dryRunOption(),
+		})
+	})
 
 }
 
-func CreateOrUpdateServiceAccount(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string) error {
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		resultGet, getErr := GetServiceAccount(objectMeta.Name, objectMeta.Namespace)
-		if getErr != nil {
-			log.Printf("Error getting ServiceAccount: %v \n", err)
-			// return err
+func (c *Client) CreateOrUpdateServiceAccount(ctx context.Context, typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string) (OperationResult, error) {
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	result := OperationResultUnchanged
+	retryErr := c.createOrUpdate(ctx, KindServiceAccount, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		resultGet, getErr := c.GetServiceAccount(ctx, objectMeta.Name, objectMeta.Namespace)
+		if getErr != nil && !apierrors.IsNotFound(getErr) {
+			return getErr
 		}
 
-		if resultGet != nil {
-			err := UpdateServiceAccount(resultGet, secretsArrStr, imageSecret)
+		if getErr == nil {
+			if serviceAccountUnchanged(resultGet, secretsArrStr, imageSecret) && c.metadataUpToDate(resultGet, objectMeta) {
+				result = OperationResultUnchanged
+				return nil
+			}
+
+			setMetadata(resultGet, objectMeta)
+			err := c.UpdateServiceAccount(ctx, resultGet, secretsArrStr, imageSecret)
 			if err != nil {
-				log.Printf("Error updating ServiceAccount: %v \n", err)
 				return err
 			}
+			result = OperationResultUpdated
 		} else {
-			err := CreateServiceAccount(typeMeta, objectMeta, secretsArrStr, imageSecret)
+			err := c.CreateServiceAccount(ctx, typeMeta, objectMeta, secretsArrStr, imageSecret)
 			if err != nil {
-				log.Printf("Error creating ServiceAccount: %v \n", err)
 				return err
 			}
+			result = OperationResultCreated
 		}
 		return nil
 	})
 	if retryErr != nil {
-		return retryErr
+		return OperationResultUnchanged, retryErr
+	}
+	return result, nil
+}
+
+// ApplyServiceAccount creates or updates the service account using
+// server-side apply, so only the fields given here are owned by the field
+// manager.
+func (c *Client) ApplyServiceAccount(ctx context.Context, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string, applyOptions ApplyOptions) error {
+
+	objectMeta.Namespace = c.resolveNamespace(objectMeta.Namespace)
+
+	serviceAccountApply := corev1ac.ServiceAccount(objectMeta.Name, objectMeta.Namespace).
+		WithLabels(objectMeta.Labels).
+		WithAnnotations(objectMeta.Annotations)
+
+	for _, s := range secretsArrStr {
+		serviceAccountApply = serviceAccountApply.WithSecrets(corev1ac.ObjectReference().WithName(s))
+	}
+
+	if imageSecret != "" {
+		serviceAccountApply = serviceAccountApply.WithImagePullSecrets(corev1ac.LocalObjectReference().WithName(imageSecret))
+	}
+
+	labels, annotations, err := c.driftStamps(serviceAccountApply)
+	if err != nil {
+		return newError(OpApply, KindServiceAccount, objectMeta.Namespace, objectMeta.Name, err)
+	}
+	serviceAccountApply.WithLabels(labels).WithAnnotations(annotations)
+
+	return c.do(ctx, OpApply, KindServiceAccount, objectMeta.Namespace, objectMeta.Name, func(ctx context.Context) error {
+		_, err := c.clientset.CoreV1().ServiceAccounts(objectMeta.Namespace).Apply(ctx, serviceAccountApply, c.applyOptions(applyOptions))
+		return applyError(KindServiceAccount, objectMeta.Namespace, objectMeta.Name, err)
+	})
+
+}
+
+// serviceAccountUnchanged reports whether the service account already
+// references the desired secrets and image pull secret.
+func serviceAccountUnchanged(objServiceAccount *v1.ServiceAccount, secretsArrStr []string, imageSecret string) bool {
+
+	secretReferences := []v1.ObjectReference{}
+
+	for _, s := range secretsArrStr {
+		secretReferences = append(secretReferences, v1.ObjectReference{
+			Name: s,
+		})
+	}
+
+	imagePullSecrets := []v1.LocalObjectReference{
+		{
+			Name: imageSecret,
+		},
 	}
-	return nil
+
+	return equality.Semantic.DeepEqual(objServiceAccount.Secrets, secretReferences) &&
+		equality.Semantic.DeepEqual(objServiceAccount.ImagePullSecrets, imagePullSecrets)
+
+}
+
+// CreateServiceAccount calls Client.CreateServiceAccount on the default client.
+func CreateServiceAccount(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string) error {
+	return defaultClient().CreateServiceAccount(context.Background(), typeMeta, objectMeta, secretsArrStr, imageSecret)
+}
+
+// GetServiceAccount calls Client.GetServiceAccount on the default client.
+func GetServiceAccount(name, namespace string) (*v1.ServiceAccount, error) {
+	return defaultClient().GetServiceAccount(context.Background(), name, namespace)
+}
+
+// UpdateServiceAccount calls Client.UpdateServiceAccount on the default client.
+func UpdateServiceAccount(objServiceAccount *v1.ServiceAccount, secretsArrStr []string, imageSecret string) error {
+	return defaultClient().UpdateServiceAccount(context.Background(), objServiceAccount, secretsArrStr, imageSecret)
+}
+
+// ListServiceAccount calls Client.ListServiceAccount on the default client, without list options.
+func ListServiceAccount(namespace string) (*v1.ServiceAccountList, error) {
+	return defaultClient().ListServiceAccount(context.Background(), namespace, ListOptions{})
+}
+
+// EachServiceAccount calls Client.EachServiceAccount on the default client.
+func EachServiceAccount(namespace string, listOptions ListOptions, fn func(*v1.ServiceAccount) error) error {
+	return defaultClient().EachServiceAccount(context.Background(), namespace, listOptions, fn)
+}
+
+// WatchServiceAccount calls Client.WatchServiceAccount on the default client.
+func WatchServiceAccount(namespace string, listOptions ListOptions, fn func(ServiceAccountEvent) error) error {
+	return defaultClient().WatchServiceAccount(context.Background(), namespace, listOptions, fn)
+}
+
+// DeleteServiceAccount calls Client.DeleteServiceAccount on the default client.
+func DeleteServiceAccount(name, namespace string) error {
+	return defaultClient().DeleteServiceAccount(context.Background(), name, namespace)
+}
+
+// CreateOrUpdateServiceAccount calls Client.CreateOrUpdateServiceAccount on the default client.
+func CreateOrUpdateServiceAccount(typeMeta Metav1TypeMeta, objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string) (OperationResult, error) {
+	return defaultClient().CreateOrUpdateServiceAccount(context.Background(), typeMeta, objectMeta, secretsArrStr, imageSecret)
+}
+
+// ApplyServiceAccount calls Client.ApplyServiceAccount on the default client.
+func ApplyServiceAccount(objectMeta Metav1ObjectMeta, secretsArrStr []string, imageSecret string, applyOptions ApplyOptions) error {
+	return defaultClient().ApplyServiceAccount(context.Background(), objectMeta, secretsArrStr, imageSecret, applyOptions)
 }
@@ -0,0 +1,51 @@
+package clientk8s
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/rootbean/by-client-k8s/pkg/client-k8s"
+
+// Span attributes set on every operation.
+const (
+	attributeVerb      = attribute.Key("k8s.verb")
+	attributeKind      = attribute.Key("k8s.kind")
+	attributeNamespace = attribute.Key("k8s.namespace")
+	attributeName      = attribute.Key("k8s.name")
+)
+
+// WithTracerProvider sets the provider of the spans wrapping every operation
+// and the HTTP requests sent to the API server. Defaults to the global
+// provider.
+func WithTracerProvider(tracerProvider trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracerProvider = tracerProvider
+	}
+}
+
+// startSpan starts the span of an operation. The HTTP requests sent with the
+// returned context are nested under it.
+func (c *Client) startSpan(ctx context.Context, op, kind, namespace, name string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "clientk8s "+op+" "+kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attributeVerb.String(op),
+			attributeKind.String(kind),
+			attributeNamespace.String(namespace),
+			attributeName.String(name),
+		),
+	)
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,318 @@
+package clientk8s
+
+import (
+	"context"
+	"math"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// EventType is the kind of change reported by the Watch* functions.
+type EventType string
+
+// Types of the watch events.
+const (
+	EventAdded    EventType = "Added"
+	EventModified EventType = "Modified"
+	EventDeleted  EventType = "Deleted"
+)
+
+// watchFuncs lists and watches the objects of a kind.
+type watchFuncs struct {
+	list  func(context.Context, metav1.ListOptions) (runtime.Object, error)
+	watch func(context.Context, metav1.ListOptions) (watch.Interface, error)
+}
+
+// watcher keeps a watch running across disconnections. It remembers the last
+// resourceVersion seen, to resume the watch where it stopped, and the objects
+// seen, to report the changes missed when the watch has to start over from a
+// new list.
+type watcher struct {
+	client      *Client
+	kind        string
+	namespace   string
+	listOptions ListOptions
+	funcs       watchFuncs
+	fn          func(EventType, runtime.Object) error
+
+	resourceVersion string
+	known           map[string]runtime.Object
+	// handlerErr is the error returned by fn, which stops the watch.
+	handlerErr error
+}
+
+// watch calls fn for every change of the objects of kind matching
+// listOptions, until ctx is cancelled or fn returns an error.
+//
+// Without a ListOptions.ResourceVersion, the objects are listed first and
+// reported as added. The watch then resumes from the last resourceVersion
+// every time the API server closes it, backing off on transient errors and
+// when it closes before any event. When that resourceVersion is too old (410
+// Gone), the objects are listed again and the changes missed in between are
+// reported.
+func (c *Client) watch(ctx context.Context, kind, namespace string, listOptions ListOptions, funcs watchFuncs, fn func(EventType, runtime.Object) error) error {
+
+	if c.err != nil {
+		return newError(OpWatch, kind, namespace, "", c.err)
+	}
+
+	w := &watcher{
+		client:          c,
+		kind:            kind,
+		namespace:       namespace,
+		listOptions:     listOptions,
+		funcs:           funcs,
+		fn:              fn,
+		resourceVersion: listOptions.ResourceVersion,
+		known:           map[string]runtime.Object{},
+	}
+
+	return w.run(ctx)
+
+}
+
+func (w *watcher) run(ctx context.Context) error {
+
+	relist := w.resourceVersion == ""
+	backoff := watchBackoff()
+
+	for {
+
+		var err error
+		received := false
+		if relist {
+			err = w.relist(ctx)
+		}
+		if err == nil {
+			relist = false
+			received, err = w.watch(ctx)
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case w.handlerErr != nil:
+			return w.handlerErr
+		case err == nil && received:
+			backoff = watchBackoff()
+			continue
+		case err == nil:
+			// A watch closed before any event, as by a proxy dropping the
+			// stream, is backed off rather than reopened in a tight loop.
+			delay := backoff.Step()
+			w.client.logger.V(1).Info("Watch closed without events, reconnecting", "kind", w.kind, "namespace", w.namespace, "delay", delay)
+			if !sleepContext(ctx, delay) {
+				return nil
+			}
+			continue
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			w.client.logger.V(1).Info("Watch expired, listing again", "kind", w.kind, "namespace", w.namespace, "resourceVersion", w.resourceVersion)
+			relist = true
+			continue
+		case !IsRetryable(err) && !IsCircuitOpen(err):
+			return err
+		}
+
+		delay := backoff.Step()
+		w.client.logger.V(1).Info("Watch failed, reconnecting", "kind", w.kind, "namespace", w.namespace, "delay", delay, "error", err.Error())
+		if !sleepContext(ctx, delay) {
+			return nil
+		}
+
+	}
+
+}
+
+// sleepContext waits for delay, and reports false when ctx is cancelled
+// first.
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+
+}
+
+// watchBackoff is the wait between reconnections after an error.
+func watchBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      30 * time.Second,
+	}
+}
+
+// relist lists the objects, reports the changes since the objects last seen
+// and records the resourceVersion to watch from.
+func (w *watcher) relist(ctx context.Context) error {
+
+	opts := w.listOptions
+	opts.ResourceVersion = ""
+	opts.ResourceVersionMatch = ""
+	opts.Continue = ""
+	opts.Limit = 0
+
+	list, _, err := w.client.newPager(w.kind, w.namespace, w.funcs.list).List(ctx, opts.metav1())
+	if err != nil {
+		return err
+	}
+
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return newError(OpList, w.kind, w.namespace, "", err)
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return newError(OpList, w.kind, w.namespace, "", err)
+	}
+
+	seen := map[string]bool{}
+
+	for _, obj := range items {
+		key := objectKey(obj)
+		seen[key] = true
+
+		previous, found := w.known[key]
+		w.known[key] = obj
+
+		switch {
+		case !found:
+			err = w.emit(EventAdded, obj)
+		case resourceVersion(previous) != resourceVersion(obj):
+			err = w.emit(EventModified, obj)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, obj := range w.known {
+		if seen[key] {
+			continue
+		}
+		delete(w.known, key)
+		if err := w.emit(EventDeleted, obj); err != nil {
+			return err
+		}
+	}
+
+	w.resourceVersion = listMeta.GetResourceVersion()
+
+	return nil
+
+}
+
+// watch reports the events of a single watch request, until the API server
+// closes it or reports an error. received tells whether any event, bookmarks
+// included, was received.
+func (w *watcher) watch(ctx context.Context) (received bool, err error) {
+
+	opts := w.listOptions.metav1()
+	opts.ResourceVersion = w.resourceVersion
+	opts.ResourceVersionMatch = ""
+	opts.Continue = ""
+	opts.Limit = 0
+	opts.AllowWatchBookmarks = true
+
+	var watchInterface watch.Interface
+
+	err = w.client.do(ctx, OpWatch, w.kind, w.namespace, "", func(ctx context.Context) error {
+		var err error
+		watchInterface, err = w.funcs.watch(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	defer watchInterface.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return received, nil
+		case event, ok := <-watchInterface.ResultChan():
+			if !ok {
+				return received, nil
+			}
+
+			if event.Type == watch.Error {
+				return received, newError(OpWatch, w.kind, w.namespace, "", apierrors.FromObject(event.Object))
+			}
+			received = true
+
+			switch event.Type {
+			case watch.Bookmark:
+				w.resourceVersion = resourceVersion(event.Object)
+			case watch.Added, watch.Modified:
+				w.resourceVersion = resourceVersion(event.Object)
+				w.known[objectKey(event.Object)] = event.Object
+				if err := w.emit(eventType(event.Type), event.Object); err != nil {
+					return received, err
+				}
+			case watch.Deleted:
+				w.resourceVersion = resourceVersion(event.Object)
+				delete(w.known, objectKey(event.Object))
+				if err := w.emit(EventDeleted, event.Object); err != nil {
+					return received, err
+				}
+			}
+		}
+	}
+
+}
+
+// emit calls fn, recording its error so the watch stops.
+func (w *watcher) emit(eventType EventType, obj runtime.Object) error {
+	w.handlerErr = w.fn(eventType, obj)
+	return w.handlerErr
+}
+
+func eventType(eventType watch.EventType) EventType {
+	if eventType == watch.Added {
+		return EventAdded
+	}
+	return EventModified
+}
+
+// objectKey identifies an object by namespace and name.
+func objectKey(obj runtime.Object) string {
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+
+	if accessor.GetNamespace() == "" {
+		return accessor.GetName()
+	}
+
+	return accessor.GetNamespace() + "/" + accessor.GetName()
+
+}
+
+func resourceVersion(obj runtime.Object) string {
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+
+	return accessor.GetResourceVersion()
+
+}
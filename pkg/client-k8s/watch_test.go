@@ -0,0 +1,245 @@
+package clientk8s
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// watchServer fakes the list and watch requests of configmaps. Every list
+// returns the next list of lists, and every watch calls the next function of
+// watches with the resourceVersion it starts from.
+type watchServer struct {
+	mu      sync.Mutex
+	lists   []*v1.ConfigMapList
+	watches []func(resourceVersion string) watch.Interface
+	calls   int
+}
+
+func newWatchServer(t *testing.T, lists []*v1.ConfigMapList, watches ...func(resourceVersion string) watch.Interface) (*Client, *watchServer) {
+
+	server := &watchServer{lists: lists, watches: watches}
+	clientset := fake.NewSimpleClientset()
+
+	clientset.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if len(server.lists) == 0 {
+			t.Error("unexpected list")
+			return true, &v1.ConfigMapList{}, nil
+		}
+		list := server.lists[0]
+		server.lists = server.lists[1:]
+		return true, list, nil
+	})
+
+	clientset.PrependWatchReactor("configmaps", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		server.calls++
+		if len(server.watches) == 0 {
+			return true, watch.NewFake(), nil
+		}
+		next := server.watches[0]
+		server.watches = server.watches[1:]
+		return true, next(action.(k8stesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion), nil
+	})
+
+	return NewClientFromClientset(clientset), server
+
+}
+
+func (s *watchServer) watchCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// events returns a closed watch sending events.
+func events(events ...watch.Event) watch.Interface {
+
+	w := watch.NewRaceFreeFake()
+	for _, event := range events {
+		w.Action(event.Type, event.Object)
+	}
+	w.Stop()
+
+	return w
+
+}
+
+func configMap(name, resourceVersion string) *v1.ConfigMap {
+	return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", ResourceVersion: resourceVersion}}
+}
+
+func configMapList(resourceVersion string, items ...*v1.ConfigMap) *v1.ConfigMapList {
+
+	list := &v1.ConfigMapList{ListMeta: metav1.ListMeta{ResourceVersion: resourceVersion}}
+	for _, item := range items {
+		list.Items = append(list.Items, *item)
+	}
+
+	return list
+
+}
+
+// recordedEvent is an event as "<type> <name>@<resourceVersion>".
+func recordedEvent(event ConfigMapEvent) string {
+	return string(event.Type) + " " + event.ConfigMap.Name + "@" + event.ConfigMap.ResourceVersion
+}
+
+// runWatch runs WatchConfigMap until stop reports true for the events
+// recorded so far, and returns them.
+func runWatch(t *testing.T, c *Client, listOptions ListOptions, stop func(events []string) bool) []string {
+
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var recorded []string
+	err := c.WatchConfigMap(ctx, "default", listOptions, func(event ConfigMapEvent) error {
+		recorded = append(recorded, recordedEvent(event))
+		if stop(recorded) {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WatchConfigMap() error = %v", err)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		t.Fatalf("WatchConfigMap() timed out after events %v", recorded)
+	}
+
+	return recorded
+
+}
+
+func TestWatchResumesFromLastResourceVersion(t *testing.T) {
+
+	var resumedFrom string
+
+	c, _ := newWatchServer(t,
+		[]*v1.ConfigMapList{configMapList("10", configMap("a", "5"))},
+		func(resourceVersion string) watch.Interface {
+			if resourceVersion != "10" {
+				t.Errorf("first watch from %q, want 10", resourceVersion)
+			}
+			return events(watch.Event{Type: watch.Modified, Object: configMap("a", "11")})
+		},
+		func(resourceVersion string) watch.Interface {
+			resumedFrom = resourceVersion
+			return events(watch.Event{Type: watch.Added, Object: configMap("b", "12")})
+		},
+	)
+
+	got := runWatch(t, c, ListOptions{}, func(events []string) bool { return len(events) == 3 })
+
+	if want := []string{"Added a@5", "Modified a@11", "Added b@12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if resumedFrom != "11" {
+		t.Errorf("watch resumed from %q, want 11", resumedFrom)
+	}
+
+}
+
+func TestWatchRelistsWhenExpired(t *testing.T) {
+
+	expired := &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusGone,
+		Reason:  metav1.StatusReasonExpired,
+		Message: "too old resource version",
+	}
+
+	var relistedFrom string
+
+	c, _ := newWatchServer(t,
+		[]*v1.ConfigMapList{
+			configMapList("10", configMap("a", "1"), configMap("b", "1")),
+			// a changed, b was deleted and c created while disconnected.
+			configMapList("20", configMap("a", "2"), configMap("c", "5")),
+		},
+		func(string) watch.Interface {
+			return events(watch.Event{Type: watch.Error, Object: expired})
+		},
+		func(resourceVersion string) watch.Interface {
+			relistedFrom = resourceVersion
+			return events(watch.Event{Type: watch.Added, Object: configMap("d", "21")})
+		},
+	)
+
+	got := runWatch(t, c, ListOptions{}, func(events []string) bool { return len(events) == 6 })
+
+	want := []string{"Added a@1", "Added b@1", "Modified a@2", "Added c@5", "Deleted b@1", "Added d@21"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if relistedFrom != "20" {
+		t.Errorf("watch after the list from %q, want 20", relistedFrom)
+	}
+
+}
+
+func TestWatchStopsOnContextCancel(t *testing.T) {
+
+	c, server := newWatchServer(t, nil, func(string) watch.Interface {
+		return watch.NewFake()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.WatchConfigMap(ctx, "default", ListOptions{ResourceVersion: "10"}, func(ConfigMapEvent) error { return nil })
+	}()
+
+	for server.watchCalls() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WatchConfigMap() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchConfigMap() didn't return after the context was cancelled")
+	}
+
+}
+
+func TestWatchBacksOffWhenClosedWithoutEvents(t *testing.T) {
+
+	c, server := newWatchServer(t, nil,
+		func(string) watch.Interface { return events() },
+		func(string) watch.Interface { return events() },
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.WatchConfigMap(ctx, "default", ListOptions{ResourceVersion: "10"}, func(ConfigMapEvent) error { return nil })
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	<-done
+
+	if calls := server.watchCalls(); calls != 1 {
+		t.Errorf("watch requests = %d, want 1 within the first backoff", calls)
+	}
+
+}